@@ -0,0 +1,209 @@
+package ctoc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ArchiveSeparator separates the path of an archive and the path of a file in it, e.g. archive.tgz!/path/in/archive.
+const ArchiveSeparator string = "!/"
+
+// errArchiveFileFound stops walking an archive when the opened file is found.
+var errArchiveFileFound = errors.New("archive file found")
+
+// shebangPeekSize is the number of the first bytes of an archive file peeked for a shebang.
+const shebangPeekSize = 256
+
+// isArchive reports whether the file is an archive which is analyzed without extracting it.
+func isArchive(filename string) bool {
+	name := strings.ToLower(filename)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkArchive calls visit with each regular file of a zip, tar or gzipped tar archive,
+// the content which is not read by visit is skipped without being buffered.
+func walkArchive(filename string, visit func(name string, info os.FileInfo, r io.Reader) error) error {
+	if strings.HasSuffix(strings.ToLower(filename), ".zip") {
+		return walkZipArchive(filename, visit)
+	}
+
+	fp, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	var r io.Reader = fp
+	if name := strings.ToLower(filename); strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") {
+		gz, err := gzip.NewReader(fp)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := visit(header.Name, header.FileInfo(), tr); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZipArchive(filename string, visit func(name string, info os.FileInfo, r io.Reader) error) error {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		info := file.FileInfo()
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		fp, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		err = visit(file.Name, info, fp)
+		fp.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addArchiveFiles adds the files in the archive to result, as archive!/path/in/archive.
+// Each file is analyzed as soon as it is read, only the results are kept until the analysis, and opts
+// reads the archive again when the file is opened later, e.g. by Diff.
+func addArchiveFiles(result map[string]*Language, archive string, languages *DefinedLanguages, opts *ClocOptions, fileCache map[string]struct{}) error {
+	if opts.archived == nil {
+		opts.archived = make(map[string]*ClocFile)
+	}
+	if opts.archives == nil {
+		opts.archives = make(map[string]struct{})
+		open := opts.open
+		opts.open = func(name string) (io.ReadCloser, error) {
+			if i := strings.Index(name, ArchiveSeparator); i >= 0 {
+				if _, ok := opts.archives[name[:i]]; ok {
+					return openArchiveFile(name[:i], name[i+len(ArchiveSeparator):])
+				}
+			}
+			if open != nil {
+				return open(name)
+			}
+			return os.Open(name)
+		}
+	}
+	opts.archives[archive] = struct{}{}
+
+	return walkArchive(archive, func(name string, info os.FileInfo, r io.Reader) error {
+		if err := opts.context().Err(); err != nil {
+			return err
+		}
+		name = path.Clean("/" + strings.TrimPrefix(name, "./"))
+		filePath := archive + ArchiveSeparator + name[1:]
+		if ignore := checkDefaultIgnore(filePath, info, false); ignore {
+			return nil
+		}
+		if match := checkOptionMatch(filePath, info, opts); !match {
+			return nil
+		}
+
+		br := bufio.NewReader(r)
+		if !isAnalyzedArchiveFile(filePath, br, opts) {
+			return nil
+		}
+		content, err := io.ReadAll(br)
+		if err != nil {
+			return fmt.Errorf("%s: %w", archive, err)
+		}
+
+		// the file is served from content while it is analyzed
+		fileOpts := *opts
+		fileOpts.open = func(name string) (io.ReadCloser, error) {
+			if name == filePath {
+				return io.NopCloser(bytes.NewReader(content)), nil
+			}
+			return opts.open(name)
+		}
+		if language := addFile(result, filePath, languages, &fileOpts, fileCache); language != nil {
+			opts.archived[filePath] = AnalyzeFile(filePath, language, &fileOpts)
+		}
+		return nil
+	})
+}
+
+// openArchiveFile returns the content of the file in the archive.
+func openArchiveFile(archive, name string) (io.ReadCloser, error) {
+	var content []byte
+	err := walkArchive(archive, func(entry string, _ os.FileInfo, r io.Reader) error {
+		if path.Clean("/"+strings.TrimPrefix(entry, "./")) != "/"+name {
+			return nil
+		}
+		var err error
+		if content, err = io.ReadAll(r); err != nil {
+			return err
+		}
+		return errArchiveFileFound
+	})
+	if err == nil {
+		return nil, &fs.PathError{Op: "open", Path: archive + ArchiveSeparator + name, Err: fs.ErrNotExist}
+	}
+	if err != errArchiveFileFound {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// isAnalyzedArchiveFile reports whether the file in an archive may be analyzed, which is decided from its name
+// unless its language is detected from the content, only the first bytes are peeked for a shebang when the name tells no language.
+func isAnalyzedArchiveFile(filePath string, r *bufio.Reader, opts *ClocOptions) bool {
+	switch filepath.Ext(filePath) {
+	case ".m", ".v", ".fs", ".r", ".ts", ".mo":
+		return true
+	}
+
+	nameOpts := *opts
+	nameOpts.open = func(string) (io.ReadCloser, error) {
+		return nil, os.ErrNotExist
+	}
+	if ext, ok := getFileType(filePath, &nameOpts); ok {
+		if targetExt, ok := Exts[ext]; ok {
+			return checkLanguageOption(targetExt, opts)
+		}
+	}
+
+	prefix, _ := r.Peek(shebangPeekSize)
+	return bytes.HasPrefix(bytes.TrimLeftFunc(prefix, unicode.IsSpace), []byte("#!"))
+}
@@ -0,0 +1,200 @@
+package ctoc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var archiveTestFiles = []struct {
+	name    string
+	content string
+}{
+	{"./src/main.go", "package main\n\n// main function\nfunc main() {}\n"},
+	{"./src/util.py", "# util\nprint(1)\n"},
+	{"./.git/config.go", "package git\n"},
+	{"./README", "no language\n"},
+}
+
+func writeTarArchive(t *testing.T, filename string, gzipped bool) {
+	t.Helper()
+	fp, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("os.Create() error. err=[%v]", err)
+	}
+	defer fp.Close()
+
+	var w io.Writer = fp
+	if gzipped {
+		gz := gzip.NewWriter(fp)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	if err := tw.WriteHeader(&tar.Header{Name: "./src/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatalf("WriteHeader() error. err=[%v]", err)
+	}
+	for _, file := range archiveTestFiles {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(file.content))}); err != nil {
+			t.Fatalf("WriteHeader() error. err=[%v]", err)
+		}
+		if _, err := tw.Write([]byte(file.content)); err != nil {
+			t.Fatalf("Write() error. err=[%v]", err)
+		}
+	}
+}
+
+func writeZipArchive(t *testing.T, filename string) {
+	t.Helper()
+	fp, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("os.Create() error. err=[%v]", err)
+	}
+	defer fp.Close()
+
+	zw := zip.NewWriter(fp)
+	defer zw.Close()
+	if _, err := zw.Create("src/"); err != nil {
+		t.Fatalf("Create() error. err=[%v]", err)
+	}
+	for _, file := range archiveTestFiles {
+		w, err := zw.Create(file.name[2:])
+		if err != nil {
+			t.Fatalf("Create() error. err=[%v]", err)
+		}
+		if _, err := w.Write([]byte(file.content)); err != nil {
+			t.Fatalf("Write() error. err=[%v]", err)
+		}
+	}
+}
+
+func TestAnalyzeArchive(t *testing.T) {
+	dir := t.TempDir()
+	writeTarArchive(t, filepath.Join(dir, "src.tar"), false)
+	writeTarArchive(t, filepath.Join(dir, "src.tar.gz"), true)
+	writeTarArchive(t, filepath.Join(dir, "src.TGZ"), true)
+	writeZipArchive(t, filepath.Join(dir, "src.zip"))
+
+	for _, name := range []string{"src.tar", "src.tar.gz", "src.TGZ", "src.zip"} {
+		archive := filepath.Join(dir, name)
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = wordTokenizer{}
+		clocOpts.SkipDuplicated = true
+		result, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{archive})
+		if err != nil {
+			t.Fatalf("Analyze() error. archive=%v err=[%v]", name, err)
+		}
+
+		var files []string
+		for file := range result.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		expected := []string{archive + "!/src/main.go", archive + "!/src/util.py"}
+		if !reflect.DeepEqual(files, expected) {
+			t.Errorf("invalid files. archive=%v files=%v", name, files)
+		}
+		if result.Total.Code != 3 || result.Total.Comments != 2 || result.Total.Blanks != 1 {
+			t.Errorf("invalid logic. archive=%v total=%+v", name, result.Total)
+		}
+		if file := result.Files[archive+"!/src/main.go"]; file.Lang != "Go" || file.Tokens != 8 {
+			t.Errorf("invalid logic. archive=%v file=%+v", name, file)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.zip"), []byte("not a zip"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error. err=[%v]", err)
+	}
+	clocOpts := NewClocOptions()
+	if _, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{filepath.Join(dir, "broken.zip")}); err == nil {
+		t.Errorf("invalid logic. expected error for broken archive")
+	}
+}
+
+func TestAnalyzeArchiveInDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"main.go": "package main\n"})
+	if err := os.Mkdir(filepath.Join(dir, "dist"), 0o755); err != nil {
+		t.Fatalf("os.Mkdir() error. err=[%v]", err)
+	}
+	archive := filepath.Join(dir, "dist", "src.tgz")
+	writeTarArchive(t, archive, true)
+	if err := os.WriteFile(filepath.Join(dir, "dist", "broken.zip"), []byte("not a zip"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error. err=[%v]", err)
+	}
+
+	clocOpts := NewClocOptions()
+	clocOpts.SkipDuplicated = true
+	result, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{dir})
+	if err != nil {
+		t.Fatalf("Analyze() error. err=[%v]", err)
+	}
+	var files []string
+	for file := range result.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	expected := []string{archive + "!/src/main.go", archive + "!/src/util.py", filepath.Join(dir, "main.go")}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("invalid files. files=%v", files)
+	}
+
+	// the files are read from the archive again after the analysis
+	content, err := result.opts.readFile(archive + "!/src/util.py")
+	if err != nil || string(content) != "# util\nprint(1)\n" {
+		t.Errorf("invalid logic. content=%q err=[%v]", content, err)
+	}
+	if _, err := result.opts.readFile(archive + "!/src/none.go"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("invalid logic. err=[%v]", err)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestIsAnalyzedArchiveFile(t *testing.T) {
+	large := strings.Repeat("x", 64*1024)
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+		maxRead  int
+	}{
+		{"src/main.go", large, true, 0},
+		{"src/main.py", large, false, 0},
+		{"lib/app.jar", large, false, 4096},
+		{"bin/run", "#!/bin/sh\n" + large, true, 4096},
+		{"src/index.ts", large, true, 0},
+	}
+	for _, test := range tests {
+		clocOpts := NewClocOptions()
+		clocOpts.ExcludeExts = map[string]struct{}{"Python": {}}
+		r := &countingReader{r: strings.NewReader(test.content)}
+		filePath := "src.tar" + ArchiveSeparator + test.name
+		if analyzed := isAnalyzedArchiveFile(filePath, bufio.NewReader(r), clocOpts); analyzed != test.expected {
+			t.Errorf("invalid logic. name=%v analyzed=%v", test.name, analyzed)
+		}
+		if r.n > test.maxRead {
+			t.Errorf("invalid logic. name=%v read=%v", test.name, r.n)
+		}
+	}
+}
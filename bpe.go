@@ -0,0 +1,99 @@
+package ctoc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LocalBpeLoader loads tiktoken BPE ranks from local .tiktoken files instead of downloading them.
+type LocalBpeLoader struct {
+	path string
+
+	mu      sync.Mutex
+	digests map[string]string
+}
+
+// NewLocalBpeLoader returns LocalBpeLoader for a .tiktoken file or a directory containing .tiktoken files.
+func NewLocalBpeLoader(path string) *LocalBpeLoader {
+	return &LocalBpeLoader{path: path}
+}
+
+// LoadTiktokenBpe implements tiktoken.BpeLoader, tiktokenBpeFile is the download URL of the encoding.
+func (l *LocalBpeLoader) LoadTiktokenBpe(tiktokenBpeFile string) (map[string]int, error) {
+	name := path.Base(tiktokenBpeFile)
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := l.path
+	if info.IsDir() {
+		filename = filepath.Join(l.path, name)
+	} else if filepath.Base(l.path) != name {
+		return nil, fmt.Errorf("bpe file %s does not provide %s", l.path, name)
+	}
+
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	if l.digests == nil {
+		l.digests = make(map[string]string)
+	}
+	l.digests[name] = contentDigest(contents)
+	l.mu.Unlock()
+	return parseTiktokenBpe(contents)
+}
+
+// digest returns the digest of the files loaded so far, which identifies the ranks of the encodings.
+func (l *LocalBpeLoader) digest() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names := make([]string, 0, len(l.digests))
+	for name := range l.digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s:%s,", name, l.digests[name])
+	}
+	return contentDigest([]byte(sb.String()))
+}
+
+// SetBpePath makes tokenizers load encodings from a local .tiktoken file or directory.
+// It must be called before the tokenizers are created.
+func SetBpePath(path string) {
+	setBpeLoader(NewLocalBpeLoader(path))
+}
+
+func parseTiktokenBpe(contents []byte) (map[string]int, error) {
+	bpeRanks := make(map[string]int)
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, " ")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid bpe line: %q", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		rank, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		bpeRanks[string(token)] = rank
+	}
+	return bpeRanks, nil
+}
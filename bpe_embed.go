@@ -0,0 +1,14 @@
+//go:build ctoc_embed
+// +build ctoc_embed
+
+package ctoc
+
+import (
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// With the ctoc_embed build tag, the BPE ranks of all the supported encodings are
+// embedded in the binary, so no network access is needed.
+func init() {
+	setBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
@@ -0,0 +1,51 @@
+package ctoc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testBpeURL = "https://openaipublic.blob.core.windows.net/encodings/test_base.tiktoken"
+
+func TestLocalBpeLoader(t *testing.T) {
+	dir := t.TempDir()
+	// "YQ==" is "a", "Yg==" is "b"
+	if err := os.WriteFile(filepath.Join(dir, "test_base.tiktoken"), []byte("YQ== 0\nYg== 1\n"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error. err=[%v]", err)
+	}
+
+	for _, path := range []string{dir, filepath.Join(dir, "test_base.tiktoken")} {
+		ranks, err := NewLocalBpeLoader(path).LoadTiktokenBpe(testBpeURL)
+		if err != nil {
+			t.Fatalf("LoadTiktokenBpe() error. path=%v err=[%v]", path, err)
+		}
+		if len(ranks) != 2 || ranks["a"] != 0 || ranks["b"] != 1 {
+			t.Errorf("invalid ranks. path=%v ranks=%v", path, ranks)
+		}
+	}
+}
+
+func TestLocalBpeLoaderMismatchedFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "other_base.tiktoken")
+	if err := os.WriteFile(filename, []byte("YQ== 0\n"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error. err=[%v]", err)
+	}
+
+	if _, err := NewLocalBpeLoader(filename).LoadTiktokenBpe(testBpeURL); err == nil {
+		t.Errorf("invalid logic. mismatched bpe file should fail")
+	}
+	if _, err := NewLocalBpeLoader(dir).LoadTiktokenBpe(testBpeURL); err == nil {
+		t.Errorf("invalid logic. missing bpe file should fail")
+	}
+}
+
+func TestParseTiktokenBpeInvalid(t *testing.T) {
+	if _, err := parseTiktokenBpe([]byte("YQ==\n")); err == nil {
+		t.Errorf("invalid logic. line without rank should fail")
+	}
+	if _, err := parseTiktokenBpe([]byte("YQ== x\n")); err == nil {
+		t.Errorf("invalid logic. invalid rank should fail")
+	}
+}
@@ -0,0 +1,160 @@
+package ctoc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BundleFormat is the format of a bundle.
+type BundleFormat string
+
+const (
+	// BundleText writes each file after a "==> path <==" header
+	BundleText BundleFormat = "text"
+	// BundleMarkdown writes each file in a fenced code block after a "## path" heading
+	BundleMarkdown BundleFormat = "markdown"
+	// BundleXML writes each file in a <file path="path"> tag, in a CDATA section when it contains markup characters
+	BundleXML BundleFormat = "xml"
+)
+
+// BundleResult is the summary of a bundle.
+type BundleResult struct {
+	Files int `json:"files"`
+	Bytes int `json:"bytes"`
+	// Tokens is the token count of the whole bundle, including the headers and fences.
+	Tokens int32 `json:"tokens"`
+	// ContentTokens is the sum of the token counts of the files encoded one by one. Tokens - ContentTokens
+	// is not the token count of the headers and fences, tokens may merge across them and it may be negative.
+	ContentTokens  int32            `json:"content_tokens"`
+	EncodingTokens TokensByEncoding `json:"encoding_tokens,omitempty"`
+}
+
+// Bundle writes the files to analyze in the paths into one document for a prompt, in the order of
+// their paths, and returns the token count of the document. With an *Estimator tokenizer, the document
+// and the files are estimated with its own ratio, not with the ratios of the languages.
+func (p *Processor) Bundle(w io.Writer, paths []string, format BundleFormat) (*BundleResult, error) {
+	switch format {
+	case BundleText, BundleMarkdown, BundleXML:
+	default:
+		return nil, fmt.Errorf("unknown bundle format: %s", format)
+	}
+
+	runOpts := *p.opts
+	opts := &runOpts
+	languages, err := getAllFiles(paths, p.langs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	type bundleFile struct {
+		name string
+		lang string
+	}
+	var files []bundleFile
+	for _, language := range languages {
+		for _, file := range language.Files {
+			files = append(files, bundleFile{name: file, lang: language.Name})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+
+	result := &BundleResult{Files: len(files)}
+	var buf bytes.Buffer
+	if format == BundleXML {
+		buf.WriteString("<files>\n")
+	}
+	for i, file := range files {
+		content, err := opts.readFile(file.name)
+		if err != nil {
+			return nil, err
+		}
+		text := string(content)
+		if opts.Tokenizer != nil {
+			result.ContentTokens += int32(opts.Tokenizer.Count(text))
+		}
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+
+		switch format {
+		case BundleText:
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "==> %s <==\n%s", file.name, text)
+		case BundleMarkdown:
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			fence := markdownFence(text)
+			fmt.Fprintf(&buf, "## %s\n\n%s%s\n%s%s\n", file.name, fence, fenceLanguage(file.name), text, fence)
+		case BundleXML:
+			buf.WriteString("<file path=\"")
+			xml.EscapeText(&buf, []byte(file.name))
+			buf.WriteString("\" language=\"")
+			xml.EscapeText(&buf, []byte(file.lang))
+			fmt.Fprintf(&buf, "\">\n%s</file>\n", xmlCharData(text))
+		}
+	}
+	if format == BundleXML {
+		buf.WriteString("</files>\n")
+	}
+
+	bundle := buf.String()
+	result.Bytes = len(bundle)
+	if opts.Tokenizer != nil {
+		result.Tokens = int32(opts.Tokenizer.Count(bundle))
+		if len(opts.Tokenizers) > 0 {
+			result.EncodingTokens = make(TokensByEncoding, len(opts.Tokenizers)+1)
+			result.EncodingTokens[opts.Tokenizer.Name()] = result.Tokens
+			for _, extra := range opts.Tokenizers {
+				result.EncodingTokens[extra.Name()] = int32(extra.Count(bundle))
+			}
+		}
+	}
+
+	if _, err := io.WriteString(w, bundle); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// xmlCharData returns the text as the content of an XML element, in a CDATA section when it contains "<" or "&",
+// with "]]>" split across two sections.
+func xmlCharData(text string) string {
+	if !strings.ContainsAny(text, "<&") && !strings.Contains(text, "]]>") {
+		return text
+	}
+	return "<![CDATA[" + strings.ReplaceAll(text, "]]>", "]]]]><![CDATA[>") + "]]>\n"
+}
+
+// markdownFence returns a code fence longer than any backtick run in the text.
+func markdownFence(text string) string {
+	longest, run := 0, 0
+	for _, c := range text {
+		if c == '`' {
+			run++
+			if longest < run {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// fenceLanguage returns the info string of the code block of the file, which is its extension.
+func fenceLanguage(filename string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+}
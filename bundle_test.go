@@ -0,0 +1,102 @@
+package ctoc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProcessorBundle(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"main.go":  "package main\n\nfunc main() {}\n",
+		"pkg/a.py": "x = \"```\"",
+		"notes":    "no language\n",
+	})
+
+	tests := []struct {
+		format   BundleFormat
+		expected string
+	}{
+		{BundleText, "==> main.go <==\npackage main\n\nfunc main() {}\n\n==> pkg/a.py <==\nx = \"```\"\n"},
+		{BundleMarkdown, "## main.go\n\n```go\npackage main\n\nfunc main() {}\n```\n\n## pkg/a.py\n\n````py\nx = \"```\"\n````\n"},
+		{BundleXML, "<files>\n<file path=\"main.go\" language=\"Go\">\npackage main\n\nfunc main() {}\n</file>\n" +
+			"<file path=\"pkg/a.py\" language=\"Python\">\nx = \"```\"\n</file>\n</files>\n"},
+	}
+	for _, test := range tests {
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = wordTokenizer{}
+		var buf bytes.Buffer
+		result, err := NewProcessor(NewDefinedLanguages(), clocOpts).Bundle(&buf, []string{dir}, test.format)
+		if err != nil {
+			t.Fatalf("Bundle() error. err=[%v]", err)
+		}
+		bundle := string(bytes.ReplaceAll(buf.Bytes(), []byte(filepath.ToSlash(dir)+"/"), nil))
+		if bundle != test.expected {
+			t.Errorf("invalid bundle. format=%v bundle=\n%s", test.format, bundle)
+		}
+		if result.Files != 2 || result.Bytes != buf.Len() || result.ContentTokens != 8 {
+			t.Errorf("invalid logic. format=%v result=%+v", test.format, result)
+		}
+		if result.Tokens != int32(wordTokenizer{}.Count(buf.String())) {
+			t.Errorf("invalid logic, tokens of the bundle are not counted. result=%+v", result)
+		}
+	}
+
+	clocOpts := NewClocOptions()
+	clocOpts.IncludeLangs["Python"] = struct{}{}
+	var buf bytes.Buffer
+	result, err := NewProcessor(NewDefinedLanguages(), clocOpts).Bundle(&buf, []string{dir}, BundleText)
+	if err != nil {
+		t.Fatalf("Bundle() error. err=[%v]", err)
+	}
+	if result.Files != 1 {
+		t.Errorf("invalid logic, files are not filtered. result=%+v", result)
+	}
+
+	if _, err := NewProcessor(NewDefinedLanguages(), clocOpts).Bundle(&buf, []string{dir}, "html"); err == nil {
+		t.Errorf("invalid logic. expected error for unknown format")
+	}
+}
+
+func TestProcessorBundleXMLMarkup(t *testing.T) {
+	dir := t.TempDir()
+	contents := map[string]string{
+		"a.go": "package a\n\n// </file> ends the file\nvar s = \"]]>\" + \"<![CDATA[\"\n",
+		"b.go": "package b\n\nvar ok = 1 < 2 && 3 > 2\n",
+		"c.go": "package c\n",
+	}
+	writeTestFiles(t, dir, contents)
+
+	var buf bytes.Buffer
+	if _, err := NewProcessor(NewDefinedLanguages(), NewClocOptions()).Bundle(&buf, []string{dir}, BundleXML); err != nil {
+		t.Fatalf("Bundle() error. err=[%v]", err)
+	}
+
+	var bundle struct {
+		Files []struct {
+			Path    string `xml:"path,attr"`
+			Content string `xml:",chardata"`
+		} `xml:"file"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &bundle); err != nil {
+		t.Fatalf("xml.Unmarshal() error. err=[%v] bundle=\n%s", err, buf.String())
+	}
+	parsed := make(map[string]string)
+	for _, file := range bundle.Files {
+		rel, _ := filepath.Rel(dir, file.Path)
+		parsed[filepath.ToSlash(rel)] = file.Content
+	}
+	expected := make(map[string]string)
+	for name, content := range contents {
+		expected[name] = "\n" + content
+		if name != "c.go" {
+			expected[name] += "\n"
+		}
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("invalid bundle. files=%q", parsed)
+	}
+}
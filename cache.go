@@ -0,0 +1,185 @@
+package ctoc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheFileName is the name of the cache file in the cache directory.
+const CacheFileName string = "ctoc-cache.json"
+
+// DefaultCacheMaxAge is the default MaxAge of Cache.
+const DefaultCacheMaxAge = 30 * 24 * time.Hour
+
+// cacheFormat is bumped when the cached ClocFile or the counting logic changes.
+const cacheFormat = "2"
+
+// cacheTouchInterval is the interval of updating the last use of an entry, so the cache file is not
+// written again by every run using the same entries.
+const cacheTouchInterval = 24 * time.Hour
+
+// Cache stores the ClocFile of analyzed files on disk, keyed by the hash of the file content,
+// the language definition and the tokenizers, so unchanged files are not analyzed again.
+// All the entries are dropped when the ctoc version changes.
+type Cache struct {
+	// MaxAge is the duration after which an entry not used is dropped, DefaultCacheMaxAge by default.
+	MaxAge time.Duration
+
+	path    string
+	version string
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	dirty   bool
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	File *ClocFile `json:"file"`
+	Used time.Time `json:"used"`
+}
+
+type cacheFile struct {
+	Version string                 `json:"version"`
+	Entries map[string]*cacheEntry `json:"entries"`
+}
+
+// OpenCache returns Cache stored in dir for the ctoc version, an invalid or outdated cache file is ignored.
+func OpenCache(dir, version string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		MaxAge:  DefaultCacheMaxAge,
+		path:    filepath.Join(dir, CacheFileName),
+		version: cacheFormat + ":" + version,
+		entries: make(map[string]*cacheEntry),
+		now:     time.Now,
+	}
+
+	content, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cf cacheFile
+	if err := json.Unmarshal(content, &cf); err == nil && cf.Version == c.version {
+		for key, entry := range cf.Entries {
+			if entry != nil && entry.File != nil {
+				c.entries[key] = entry
+			}
+		}
+	}
+	return c, nil
+}
+
+// Save writes the cache file, the entries not used for MaxAge are dropped.
+// The entries of other trees analyzed with the same cache are kept until they expire.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expired := c.now().Add(-c.MaxAge)
+	for key, entry := range c.entries {
+		if c.MaxAge > 0 && entry.Used.Before(expired) {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+	content, err := json.Marshal(cacheFile{Version: c.version, Entries: c.entries})
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so concurrent runs never read a partial cache file
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), CacheFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+func (c *Cache) get(key string) (*ClocFile, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if now := c.now(); now.Sub(entry.Used) > cacheTouchInterval {
+		entry.Used = now
+		c.dirty = true
+	}
+	return entry.File, true
+}
+
+func (c *Cache) put(key string, clocFile *ClocFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = &cacheEntry{File: clocFile, Used: c.now()}
+	c.dirty = true
+}
+
+// cacheKey returns the hash of the file content, the language definition and the tokenizer options.
+func cacheKey(content []byte, language *Language, opts *ClocOptions) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%q\x00%q\x00%v\x00%v\x00", language.Name, language.lineComments, language.multiLines,
+		language.BytesPerToken, language.TokensErrorRate)
+	var names []string
+	if opts.Tokenizer != nil {
+		names = append(names, tokenizerCacheName(opts.Tokenizer))
+	}
+	for _, tokenizer := range opts.Tokenizers {
+		names = append(names, tokenizerCacheName(tokenizer))
+	}
+	fmt.Fprintf(h, "%s\x00%v\x00", strings.Join(names, ","), opts.WholeFile)
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// definitionDigester is implemented by the tokenizers whose definition is not identified by their name,
+// e.g. loaded from a file, so the cache is not reused for another definition with the same name.
+type definitionDigester interface {
+	definitionDigest() string
+}
+
+// tokenizerCacheName returns the name and the digest of the definition of the tokenizer.
+func tokenizerCacheName(tokenizer Tokenizer) string {
+	if d, ok := tokenizer.(definitionDigester); ok && d.definitionDigest() != "" {
+		return tokenizer.Name() + "@" + d.definitionDigest()
+	}
+	return tokenizer.Name()
+}
+
+// contentDigest returns the hex encoded sha256 hash of the content.
+func contentDigest(content []byte) string {
+	h := sha256.Sum256(content)
+	return hex.EncodeToString(h[:])
+}
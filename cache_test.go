@@ -0,0 +1,194 @@
+package ctoc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTokenizer is a wordTokenizer counting the calls of Count.
+type countingTokenizer struct {
+	wordTokenizer
+	calls *int32
+}
+
+func (c countingTokenizer) Count(text string) int {
+	atomic.AddInt32(c.calls, 1)
+	return c.wordTokenizer.Count(text)
+}
+
+func analyzeWithCache(t *testing.T, dir, cacheDir, version string, languages *DefinedLanguages) (*Result, int32) {
+	t.Helper()
+	cache, err := OpenCache(cacheDir, version)
+	if err != nil {
+		t.Fatalf("OpenCache() error. err=[%v]", err)
+	}
+	var calls int32
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = countingTokenizer{calls: &calls}
+	clocOpts.Cache = cache
+	result, err := NewProcessor(languages, clocOpts).Analyze([]string{dir})
+	if err != nil {
+		t.Fatalf("Analyze() error. err=[%v]", err)
+	}
+	return result, calls
+}
+
+func TestAnalyzeWithCache(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	goFile := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(goFile, []byte("package main\n\n// hello world\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error. err=[%v]", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.py"), []byte("# hello\nprint(1)\n"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error. err=[%v]", err)
+	}
+
+	expected, calls := analyzeWithCache(t, dir, cacheDir, "v1", NewDefinedLanguages())
+	if calls != 6 {
+		t.Errorf("invalid logic. calls=%v", calls)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, CacheFileName)); err != nil {
+		t.Errorf("cache file is not saved. err=[%v]", err)
+	}
+
+	actual, calls := analyzeWithCache(t, dir, cacheDir, "v1", NewDefinedLanguages())
+	if calls != 0 {
+		t.Errorf("invalid logic, files are analyzed again. calls=%v", calls)
+	}
+	if !reflect.DeepEqual(actual.Files, expected.Files) {
+		t.Errorf("invalid cached result. expected=%+v actual=%+v", expected.Files, actual.Files)
+	}
+	if actual.Total.Tokens != expected.Total.Tokens || actual.Total.CommentTokens != expected.Total.CommentTokens {
+		t.Errorf("invalid cached total. expected=%+v actual=%+v", expected.Total, actual.Total)
+	}
+
+	// changed content
+	if err := os.WriteFile(goFile, []byte("package main\n"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error. err=[%v]", err)
+	}
+	if _, calls := analyzeWithCache(t, dir, cacheDir, "v1", NewDefinedLanguages()); calls != 1 {
+		t.Errorf("invalid logic, changed file is not analyzed. calls=%v", calls)
+	}
+
+	// changed language definition
+	languages := NewDefinedLanguages()
+	languages.Langs["Python"] = NewLanguage("Python", []string{"//"}, [][]string{{"", ""}})
+	result, calls := analyzeWithCache(t, dir, cacheDir, "v1", languages)
+	if calls != 2 {
+		t.Errorf("invalid logic, file of changed language is not analyzed. calls=%v", calls)
+	}
+	if result.Languages["Python"].Comments != 0 {
+		t.Errorf("invalid logic. comments=%v", result.Languages["Python"].Comments)
+	}
+
+	// changed version
+	if _, calls := analyzeWithCache(t, dir, cacheDir, "v2", languages); calls != 3 {
+		t.Errorf("invalid logic, files are not analyzed for new version. calls=%v", calls)
+	}
+}
+
+func TestCacheSaveKeepsEntries(t *testing.T) {
+	cacheDir := t.TempDir()
+	dirs := []string{t.TempDir(), t.TempDir()}
+	writeTestFiles(t, dirs[0], map[string]string{"a.go": "package a\n"})
+	writeTestFiles(t, dirs[1], map[string]string{"b.go": "package b\n"})
+
+	cache, err := OpenCache(cacheDir, "v1")
+	if err != nil {
+		t.Fatalf("OpenCache() error. err=[%v]", err)
+	}
+	var calls int32
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = countingTokenizer{calls: &calls}
+	clocOpts.Cache = cache
+	if _, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze(dirs); err != nil {
+		t.Fatalf("Analyze() error. err=[%v]", err)
+	}
+
+	// the entries not used by the first run are still used by the second run of the same cache
+	clocOpts.Cache, err = OpenCache(cacheDir, "v1")
+	if err != nil {
+		t.Fatalf("OpenCache() error. err=[%v]", err)
+	}
+	calls = 0
+	for _, dir := range dirs {
+		if _, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{dir}); err != nil {
+			t.Fatalf("Analyze() error. err=[%v]", err)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("invalid logic, files are analyzed again. calls=%v", calls)
+	}
+}
+
+func TestCacheKeyTokenizerDefinition(t *testing.T) {
+	language := NewDefinedLanguages().Langs["Go"]
+	key := func(tokenizer Tokenizer) string {
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = tokenizer
+		return cacheKey([]byte("package main\n"), language, clocOpts)
+	}
+
+	// tokenizer files with the same name but different contents
+	if key(&HFTokenizer{name: "llama", digest: "a"}) == key(&HFTokenizer{name: "llama", digest: "b"}) {
+		t.Errorf("invalid logic. HF tokenizer definition is not in the key")
+	}
+	if key(&SentencePieceTokenizer{name: "gemma", digest: "a"}) == key(&SentencePieceTokenizer{name: "gemma", digest: "b"}) {
+		t.Errorf("invalid logic. SentencePiece tokenizer definition is not in the key")
+	}
+	estimator := NewEstimator()
+	calibrated := NewEstimator()
+	calibrated.BytesPerToken = 2
+	if key(estimator) == key(calibrated) {
+		t.Errorf("invalid logic. estimator ratio is not in the key")
+	}
+	if key(wordTokenizer{}) != key(wordTokenizer{}) {
+		t.Errorf("invalid logic. key is not stable")
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	cacheDir := t.TempDir()
+	dirs := []string{t.TempDir(), t.TempDir()}
+	writeTestFiles(t, dirs[0], map[string]string{"a.go": "package a\n"})
+	writeTestFiles(t, dirs[1], map[string]string{"b.go": "package b\n"})
+
+	now := time.Now()
+	analyze := func(dir string) int32 {
+		cache, err := OpenCache(cacheDir, "v1")
+		if err != nil {
+			t.Fatalf("OpenCache() error. err=[%v]", err)
+		}
+		cache.now = func() time.Time { return now }
+		var calls int32
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = countingTokenizer{calls: &calls}
+		clocOpts.Cache = cache
+		if _, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{dir}); err != nil {
+			t.Fatalf("Analyze() error. err=[%v]", err)
+		}
+		return calls
+	}
+
+	// alternating between two trees keeps the entries of both
+	analyze(dirs[0])
+	analyze(dirs[1])
+	now = now.Add(DefaultCacheMaxAge - time.Hour)
+	if calls := analyze(dirs[0]); calls != 0 {
+		t.Errorf("invalid logic, files are analyzed again. calls=%v", calls)
+	}
+
+	// the entries of the other tree expire, the entries used recently are kept
+	now = now.Add(2 * time.Hour)
+	if calls := analyze(dirs[0]); calls != 0 {
+		t.Errorf("invalid logic, files are analyzed again. calls=%v", calls)
+	}
+	if calls := analyze(dirs[1]); calls != 1 {
+		t.Errorf("invalid logic, expired files are not analyzed again. calls=%v", calls)
+	}
+}
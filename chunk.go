@@ -0,0 +1,246 @@
+package ctoc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Chunk is a part of a file aligned to line boundaries.
+type Chunk struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	// StartLine and EndLine are the 1-based range of the lines of the chunk, inclusive.
+	StartLine int   `json:"start_line"`
+	EndLine   int   `json:"end_line"`
+	Tokens    int32 `json:"tokens"`
+	// Symbol is the names of the top-level declarations in the chunk, when chunked by syntax.
+	Symbol string `json:"symbol,omitempty"`
+	Text   string `json:"text,omitempty"`
+}
+
+// ChunkOptions is the options of chunking.
+type ChunkOptions struct {
+	// MaxTokens is the maximum number of tokens of a chunk, a single line with more tokens is a chunk by itself.
+	MaxTokens int32
+	// Overlap is the maximum number of tokens of the last lines of a chunk repeated at the start of the next chunk.
+	Overlap int32
+	// Syntax splits the files at top-level declarations, a declaration with more than MaxTokens tokens
+	// is split at line boundaries.
+	Syntax bool
+}
+
+// chunkLine is a line of a file to chunk.
+type chunkLine struct {
+	text   string
+	kind   lineKind
+	tokens int32
+}
+
+// ChunkReader splits the content of file into chunks of at most chunkOpts.MaxTokens tokens counted by
+// opts.Tokenizer. The chunks are split at line boundaries, preferably after a blank line or before a comment block.
+func ChunkReader(filename string, language *Language, file io.Reader, opts *ClocOptions, chunkOpts ChunkOptions) ([]Chunk, error) {
+	if chunkOpts.MaxTokens <= 0 {
+		return nil, fmt.Errorf("invalid max tokens of chunk: %d", chunkOpts.MaxTokens)
+	}
+	if chunkOpts.Overlap < 0 || chunkOpts.Overlap >= chunkOpts.MaxTokens {
+		return nil, fmt.Errorf("invalid overlap of chunk: %d", chunkOpts.Overlap)
+	}
+	if opts.Tokenizer == nil {
+		return nil, fmt.Errorf("no tokenizer")
+	}
+
+	lines := scanLines(filename, language, file, opts)
+	tokenizer := opts.Tokenizer
+	if estimator, ok := tokenizer.(*Estimator); ok {
+		tokenizer = estimator.ForLanguage(language)
+	}
+	if chunkOpts.Syntax {
+		return splitDeclarations(filename, language, lines, tokenizer, chunkOpts), nil
+	}
+	return splitChunks(filename, language.Name, lines, tokenizer, chunkOpts), nil
+}
+
+// scanLines returns the lines of file classified and counted by the line scanning of AnalyzeReader.
+func scanLines(filename string, language *Language, file io.Reader, opts *ClocOptions) []chunkLine {
+	var lines []chunkLine
+	lineOpts := *opts
+	lineOpts.Tokenizers = nil
+	lineOpts.WholeFile = false
+	lineOpts.onLine = func(line string, kind lineKind, tokens int32) {
+		lines = append(lines, chunkLine{text: line, kind: kind, tokens: tokens})
+	}
+	AnalyzeReader(filename, language, file, &lineOpts)
+	return lines
+}
+
+// chunkText returns the text of the lines.
+func chunkText(lines []chunkLine) string {
+	var sb strings.Builder
+	for _, line := range lines {
+		sb.WriteString(line.text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// splitChunks splits the lines into chunks, preferably after a blank line or before a comment block.
+func splitChunks(filename, lang string, lines []chunkLine, tokenizer Tokenizer, chunkOpts ChunkOptions) []Chunk {
+	text := func(start, end int) string {
+		return chunkText(lines[start:end])
+	}
+
+	var chunks []Chunk
+	for start := 0; start < len(lines); {
+		// the lines fitting within the budget, a newline is counted as a token
+		end, sum := start, int32(0)
+		for end < len(lines) && (end == start || sum+lines[end].tokens+1 <= chunkOpts.MaxTokens) {
+			sum += lines[end].tokens + 1
+			end++
+		}
+
+		// end at the last boundary in the latter half of the chunk
+		if end < len(lines) {
+			for b := end; b > start+(end-start)/2; b-- {
+				if isChunkBoundary(lines, b) {
+					end = b
+					break
+				}
+			}
+		}
+
+		content := text(start, end)
+		tokens := int32(tokenizer.Count(content))
+		for end-start > 1 && tokens > chunkOpts.MaxTokens {
+			end--
+			content = text(start, end)
+			tokens = int32(tokenizer.Count(content))
+		}
+		chunks = append(chunks, Chunk{
+			Path:      filename,
+			Language:  lang,
+			StartLine: start + 1,
+			EndLine:   end,
+			Tokens:    tokens,
+			Text:      content,
+		})
+		if end >= len(lines) {
+			break
+		}
+
+		// the next chunk starts with the last lines of the chunk within the overlap
+		next, overlap := end, int32(0)
+		for next-1 > start && overlap+lines[next-1].tokens+1 <= chunkOpts.Overlap {
+			overlap += lines[next-1].tokens + 1
+			next--
+		}
+		start = next
+	}
+	return chunks
+}
+
+// isChunkBoundary reports whether a chunk may end before lines[b],
+// which is after a blank line or before a comment block.
+func isChunkBoundary(lines []chunkLine, b int) bool {
+	return lines[b-1].kind == lineBlank || (lines[b].kind == lineComment && lines[b-1].kind != lineComment)
+}
+
+// Chunk splits the files to analyze in the paths into chunks, in the order of their paths,
+// and calls fn with each chunk. Chunk stops and returns the error when fn returns an error.
+func (p *Processor) Chunk(paths []string, chunkOpts ChunkOptions, fn func(*Chunk) error) error {
+	runOpts := *p.opts
+	opts := &runOpts
+	languages, err := getAllFiles(paths, p.langs, opts)
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string]*Language)
+	var names []string
+	for _, language := range languages {
+		for _, file := range language.Files {
+			files[file] = language
+			names = append(names, file)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fp, err := opts.openFile(name)
+		if err != nil {
+			return err
+		}
+		chunks, err := ChunkReader(name, files[name], fp, opts, chunkOpts)
+		fp.Close()
+		if err != nil {
+			return err
+		}
+		for i := range chunks {
+			if err := fn(&chunks[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// splitDeclarations splits the lines into chunks of consecutive top-level declarations.
+// A declaration with more than chunkOpts.MaxTokens tokens is split by splitChunks.
+func splitDeclarations(filename string, language *Language, lines []chunkLine, tokenizer Tokenizer, chunkOpts ChunkOptions) []Chunk {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	decls := declarations(language, lines)
+	var chunks []Chunk
+	for i := 0; i < len(decls); {
+		decl := decls[i]
+		content := chunkText(lines[decl.start:decl.end])
+		tokens := int32(tokenizer.Count(content))
+		if tokens > chunkOpts.MaxTokens {
+			for _, chunk := range splitChunks(filename, language.Name, lines[decl.start:decl.end], tokenizer, chunkOpts) {
+				chunk.StartLine += decl.start
+				chunk.EndLine += decl.start
+				chunk.Symbol = decl.symbol
+				chunks = append(chunks, chunk)
+			}
+			i++
+			continue
+		}
+
+		// the next declarations fitting within the limit are in the same chunk
+		symbols := []string{decl.symbol}
+		end := decl.end
+		for i++; i < len(decls); i++ {
+			next := chunkText(lines[decl.start:decls[i].end])
+			nextTokens := int32(tokenizer.Count(next))
+			if nextTokens > chunkOpts.MaxTokens {
+				break
+			}
+			content, tokens, end = next, nextTokens, decls[i].end
+			symbols = append(symbols, decls[i].symbol)
+		}
+		chunks = append(chunks, Chunk{
+			Path:      filename,
+			Language:  language.Name,
+			StartLine: decl.start + 1,
+			EndLine:   end,
+			Tokens:    tokens,
+			Symbol:    joinSymbols(symbols),
+			Text:      content,
+		})
+	}
+	return chunks
+}
+
+// joinSymbols returns the non-empty symbols separated by commas.
+func joinSymbols(symbols []string) string {
+	var names []string
+	for _, symbol := range symbols {
+		if symbol != "" {
+			names = append(names, symbol)
+		}
+	}
+	return strings.Join(names, ", ")
+}
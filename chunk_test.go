@@ -0,0 +1,179 @@
+package ctoc
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type chunkRange struct {
+	start, end int
+	tokens     int32
+}
+
+func chunkRanges(chunks []Chunk) []chunkRange {
+	ranges := make([]chunkRange, 0, len(chunks))
+	for _, chunk := range chunks {
+		ranges = append(ranges, chunkRange{chunk.StartLine, chunk.EndLine, chunk.Tokens})
+	}
+	return ranges
+}
+
+func TestChunkReader(t *testing.T) {
+	content := "package main\n\n// a comment\nfunc a() {}\n\nfunc b() {}\n"
+	language := NewLanguage("Go", []string{"//"}, [][]string{{"/*", "*/"}})
+
+	tests := []struct {
+		name     string
+		opts     ChunkOptions
+		expected []chunkRange
+	}{
+		{"whole", ChunkOptions{MaxTokens: 100}, []chunkRange{{1, 6, 11}}},
+		{"boundaries", ChunkOptions{MaxTokens: 8}, []chunkRange{{1, 2, 2}, {3, 4, 6}, {5, 6, 3}}},
+		{"overlap", ChunkOptions{MaxTokens: 8, Overlap: 4}, []chunkRange{{1, 2, 2}, {2, 3, 3}, {3, 4, 6}, {4, 5, 3}, {5, 6, 3}}},
+		{"oversized", ChunkOptions{MaxTokens: 2}, []chunkRange{{1, 1, 2}, {2, 2, 0}, {3, 3, 3}, {4, 4, 3}, {5, 5, 0}, {6, 6, 3}}},
+	}
+	for _, test := range tests {
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = wordTokenizer{}
+		chunks, err := ChunkReader("main.go", language, strings.NewReader(content), clocOpts, test.opts)
+		if err != nil {
+			t.Fatalf("ChunkReader() error. name=%v err=[%v]", test.name, err)
+		}
+		if ranges := chunkRanges(chunks); !reflect.DeepEqual(ranges, test.expected) {
+			t.Errorf("invalid chunks. name=%v chunks=%v", test.name, ranges)
+		}
+		for _, chunk := range chunks {
+			if chunk.Path != "main.go" || chunk.Language != "Go" {
+				t.Errorf("invalid logic. name=%v chunk=%+v", test.name, chunk)
+			}
+		}
+	}
+
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = wordTokenizer{}
+	chunks, _ := ChunkReader("main.go", language, strings.NewReader(content), clocOpts, ChunkOptions{MaxTokens: 8})
+	if chunks[1].Text != "// a comment\nfunc a() {}\n" {
+		t.Errorf("invalid text. text=%q", chunks[1].Text)
+	}
+
+	for _, opts := range []ChunkOptions{{MaxTokens: 0}, {MaxTokens: 8, Overlap: 8}, {MaxTokens: 8, Overlap: -1}} {
+		if _, err := ChunkReader("main.go", language, strings.NewReader(content), clocOpts, opts); err == nil {
+			t.Errorf("invalid logic. expected error for options %+v", opts)
+		}
+	}
+	clocOpts.Tokenizer = nil
+	if _, err := ChunkReader("main.go", language, strings.NewReader(content), clocOpts, ChunkOptions{MaxTokens: 8}); err == nil {
+		t.Errorf("invalid logic. expected error without tokenizer")
+	}
+}
+
+func TestProcessorChunk(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"main.go":  "package main\n\nfunc main() {}\n",
+		"pkg/a.py": "x = 1\ny = 2\n",
+		"notes":    "no language\n",
+	})
+
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = wordTokenizer{}
+	processor := NewProcessor(NewDefinedLanguages(), clocOpts)
+	var paths []string
+	err := processor.Chunk([]string{dir}, ChunkOptions{MaxTokens: 4}, func(chunk *Chunk) error {
+		paths = append(paths, strings.TrimPrefix(filepath.ToSlash(chunk.Path), filepath.ToSlash(dir)+"/"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Chunk() error. err=[%v]", err)
+	}
+	if expected := []string{"main.go", "main.go", "pkg/a.py", "pkg/a.py"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("invalid chunks. paths=%v", paths)
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = processor.Chunk([]string{dir}, ChunkOptions{MaxTokens: 4}, func(chunk *Chunk) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Errorf("invalid logic. err=%v calls=%v", err, calls)
+	}
+}
+
+func TestChunkReaderSyntax(t *testing.T) {
+	content := "package main\n\nimport \"fmt\"\n\n// T is a type.\ntype T struct{}\n\nfunc (t *T) Long() {\n\tfmt.Println(1)\n\tfmt.Println(2)\n}\n"
+	language := NewDefinedLanguages().Langs["Go"]
+
+	tests := []struct {
+		maxTokens int32
+		expected  []chunkRange
+		symbols   []string
+	}{
+		{8, []chunkRange{{1, 4, 4}, {5, 7, 8}, {8, 11, 8}}, []string{"package main, import", "T", "T.Long"}},
+		{6, []chunkRange{{1, 4, 4}, {5, 5, 5}, {6, 7, 3}, {8, 8, 5}, {9, 11, 3}}, []string{"package main, import", "T", "T", "T.Long", "T.Long"}},
+	}
+	for _, test := range tests {
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = wordTokenizer{}
+		chunks, err := ChunkReader("main.go", language, strings.NewReader(content), clocOpts, ChunkOptions{MaxTokens: test.maxTokens, Syntax: true})
+		if err != nil {
+			t.Fatalf("ChunkReader() error. err=[%v]", err)
+		}
+		if ranges := chunkRanges(chunks); !reflect.DeepEqual(ranges, test.expected) {
+			t.Errorf("invalid chunks. maxTokens=%v chunks=%v", test.maxTokens, ranges)
+		}
+		var symbols []string
+		for _, chunk := range chunks {
+			symbols = append(symbols, chunk.Symbol)
+		}
+		if !reflect.DeepEqual(symbols, test.symbols) {
+			t.Errorf("invalid symbols. maxTokens=%v symbols=%q", test.maxTokens, symbols)
+		}
+	}
+}
+
+func TestHeuristicDeclarations(t *testing.T) {
+	tests := []struct {
+		lang     string
+		content  string
+		expected []declaration
+	}{
+		{
+			"Python",
+			"import os\n\n# helper\n@decorator(\"(\")\ndef foo(a,\nb):\n    return a\n\nclass Bar:\n    def m(self):\n        pass\n",
+			[]declaration{{0, 2, ""}, {2, 8, "foo"}, {8, 11, "Bar"}},
+		},
+		{
+			"JavaScript",
+			"const a = {\nb: 1,\n};\n\n/* main */\nfunction main() {\n  return a; // }\n}\n",
+			[]declaration{{0, 4, ""}, {4, 8, "main"}},
+		},
+		{
+			"C",
+			"#include <stdio.h>\n\nint main(void)\n{\n}\n",
+			[]declaration{{0, 2, ""}, {2, 5, "main"}},
+		},
+		{
+			// the line of a form feed and a string is empty without the string
+			"Python",
+			"x = 1\n\f\"abc\"\ny = 2\n",
+			[]declaration{{0, 2, ""}, {2, 3, ""}},
+		},
+	}
+	for _, test := range tests {
+		language := NewDefinedLanguages().Langs[test.lang]
+		var lines []chunkLine
+		clocOpts := NewClocOptions()
+		clocOpts.onLine = func(line string, kind lineKind, tokens int32) {
+			lines = append(lines, chunkLine{text: line, kind: kind, tokens: tokens})
+		}
+		AnalyzeReader("test", language, strings.NewReader(test.content), clocOpts)
+		if decls := declarations(language, lines); !reflect.DeepEqual(decls, test.expected) {
+			t.Errorf("invalid declarations. lang=%v declarations=%+v", test.lang, decls)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yaohui-wyh/ctoc"
+)
+
+// BundleCommand is the options of the bundle command.
+type BundleCommand struct {
+	Format string `long:"format" default:"markdown" description:"format of the bundle" choice:"text" choice:"markdown" choice:"xml"`
+	Output string `long:"output" short:"o" description:"write the bundle to the file instead of stdout"`
+}
+
+// writeBundle writes the bundle of the files in paths and reports its token count,
+// to stderr when the bundle is written to stdout.
+func writeBundle(processor *ctoc.Processor, paths []string, opts *CmdOptions, bundleOpts *BundleCommand) error {
+	var w io.Writer = os.Stdout
+	report := os.Stderr
+	if bundleOpts.Output != "" {
+		fp, err := os.Create(bundleOpts.Output)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+		w = fp
+		report = os.Stdout
+	}
+
+	bundle, err := processor.Bundle(w, paths, ctoc.BundleFormat(bundleOpts.Format))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(report, "bundle: %d files, %d bytes, %d tokens (%d tokens of the files encoded one by one, difference %+d)%s\n",
+		bundle.Files, bundle.Bytes, bundle.Tokens, bundle.ContentTokens, bundle.Tokens-bundle.ContentTokens,
+		opts.bundleEncodingTokens(bundle.EncodingTokens))
+	return nil
+}
+
+// bundleEncodingTokens returns the token counts of the extra encodings for the bundle report.
+func (opts *CmdOptions) bundleEncodingTokens(tokens ctoc.TokensByEncoding) string {
+	var s string
+	for _, encoding := range opts.extraEncodings() {
+		s += fmt.Sprintf(", %s: %d tokens", encoding, tokens[encoding])
+	}
+	return s
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"github.com/yaohui-wyh/ctoc"
+)
+
+// ChunkCommand is the options of the chunk command.
+type ChunkCommand struct {
+	MaxTokens int32 `long:"max-tokens" default:"512" description:"maximum number of tokens of a chunk"`
+	Overlap   int32 `long:"overlap" default:"0" description:"number of tokens of the last lines of a chunk repeated in the next chunk"`
+	Syntax    bool  `long:"syntax" description:"split at top-level declarations and annotate the chunks with their names"`
+	Text      bool  `long:"text" description:"include the text of the chunks"`
+}
+
+// writeChunks writes the chunks of the files in paths to stdout as JSON Lines.
+func writeChunks(processor *ctoc.Processor, paths []string, chunkOpts *ChunkCommand) error {
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	encoder := json.NewEncoder(w)
+	return processor.Chunk(paths, ctoc.ChunkOptions{
+		MaxTokens: chunkOpts.MaxTokens,
+		Overlap:   chunkOpts.Overlap,
+		Syntax:    chunkOpts.Syntax,
+	}, func(chunk *ctoc.Chunk) error {
+		if !chunkOpts.Text {
+			chunk.Text = ""
+		}
+		return encoder.Encode(chunk)
+	})
+}
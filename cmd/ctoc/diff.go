@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/yaohui-wyh/ctoc"
+)
+
+const diffHeader string = "files          blank        comment           code         tokens"
+
+// analyzeDiff analyzes both sides of --diff and compares them. A side which is not
+// an existing path is a git revision of the repository in the current directory.
+func analyzeDiff(ctx context.Context, languages *ctoc.DefinedLanguages, clocOpts *ctoc.ClocOptions, from, to string) (*ctoc.DiffResult, error) {
+	fromResult, fromRoot, err := analyzeDiffSide(ctx, languages, clocOpts, from)
+	if err != nil {
+		return nil, err
+	}
+	toResult, toRoot, err := analyzeDiffSide(ctx, languages, clocOpts, to)
+	if err != nil {
+		return nil, err
+	}
+	return ctoc.Diff(fromResult, fromRoot, toResult, toRoot), nil
+}
+
+func analyzeDiffSide(ctx context.Context, languages *ctoc.DefinedLanguages, clocOpts *ctoc.ClocOptions, side string) (*ctoc.Result, string, error) {
+	sideOpts := *clocOpts
+	// a duplicated file dropped from one side only would be reported as added or removed
+	sideOpts.SkipDuplicated = true
+	root := side
+	if _, err := os.Stat(side); err != nil {
+		sideOpts.VCS = "git"
+		sideOpts.Revision = side
+		root = "."
+	}
+	// an incomplete side would be reported as removed files, so it fails the diff
+	result, err := ctoc.NewProcessor(languages, &sideOpts).AnalyzeContext(ctx, []string{root})
+	return result, root, err
+}
+
+func writeDiffResult(opts *CmdOptions, diff *ctoc.DiffResult) {
+	switch opts.OutputType {
+	case OutputTypeClocXML:
+		xmlResult := ctoc.NewXMLDiffResult(diff, opts.ByFile)
+		xmlResult.Model = opts.Model
+		xmlResult.Encode()
+	case OutputTypeJSON:
+		jsonResult := ctoc.NewJSONDiffResult(diff, opts.ByFile)
+		jsonResult.Model = opts.Model
+		buf, err := json.Marshal(jsonResult)
+		if err != nil {
+			fmt.Println(err)
+			panic("json marshal error")
+		}
+		os.Stdout.Write(buf)
+	default:
+		result := ctoc.NewJSONDiffResult(diff, opts.ByFile)
+		header := languageHeader
+		stats := result.Languages
+		nameLen := 27
+		if opts.ByFile {
+			header = fileHeader
+			stats = result.Files
+			for _, stat := range stats {
+				if nameLen < len(stat.Name) {
+					nameLen = len(stat.Name)
+				}
+			}
+		}
+		diffRowLen := nameLen + len(diffHeader) + 8
+
+		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, diffRowLen)
+		fmt.Printf("%-[2]*[1]s %[3]s\n", header, nameLen+6-len("files"), diffHeader)
+		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, diffRowLen)
+		for _, stat := range stats {
+			writeDiffStat(stat, nameLen)
+		}
+		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, diffRowLen)
+		writeDiffStat(*diff.Total, nameLen)
+		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, diffRowLen)
+	}
+}
+
+func writeDiffStat(stat ctoc.DiffStat, nameLen int) {
+	fmt.Println(stat.Name)
+	rows := []struct {
+		name  string
+		count func(ctoc.DiffCount) int32
+	}{
+		{"same", func(c ctoc.DiffCount) int32 { return c.Same }},
+		{"modified", func(c ctoc.DiffCount) int32 { return c.Modified }},
+		{"added", func(c ctoc.DiffCount) int32 { return c.Added }},
+		{"removed", func(c ctoc.DiffCount) int32 { return c.Removed }},
+	}
+	for _, row := range rows {
+		fmt.Printf(" %-[1]*[2]s %6[3]v %14[4]v %14[5]v %14[6]v %14[7]v\n",
+			nameLen-1, row.name, row.count(stat.Files), row.count(stat.Blanks), row.count(stat.Comments),
+			row.count(stat.Code), row.count(stat.Tokens))
+	}
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
-	"github.com/pkoukk/tiktoken-go"
 
 	"github.com/yaohui-wyh/ctoc"
 )
@@ -33,31 +39,171 @@ const OutputTypeJSON string = "json"
 
 const fileHeader string = "File"
 const languageHeader string = "Language"
-const commonHeader string = "files          blank        comment           code           tokens"
+const commonHeader string = "files          blank        comment           code           tokens" +
+	"    code-tokens comment-tokens   blank-tokens"
 const defaultOutputSeparator string = "-------------------------------------------------------------------------" +
 	"-------------------------------------------------------------------------" +
 	"-------------------------------------------------------------------------"
 
-var rowLen = 96
-
 // CmdOptions is gocloc command options.
 // It is necessary to use notation that follows go-flags.
 type CmdOptions struct {
-	ByFile                bool   `long:"by-file" description:"report results for every encountered source file"`
-	SortTag               string `long:"sort" default:"code" description:"sort based on a certain column" choice:"name" choice:"files" choice:"blank" choice:"comment" choice:"code" choice:"tokens"`
-	OutputType            string `long:"output-type" default:"default" description:"output type [values: default,cloc-xml,sloccount,json]"`
-	ExcludeExt            string `long:"exclude-ext" description:"exclude file name extensions (separated commas)"`
-	IncludeLang           string `long:"include-lang" description:"include language name (separated commas)"`
-	Match                 string `long:"match" description:"include file name (regex)"`
-	NotMatch              string `long:"not-match" description:"exclude file name (regex)"`
-	MatchDir              string `long:"match-d" description:"include dir name (regex)"`
-	NotMatchDir           string `long:"not-match-d" description:"exclude dir name (regex)"`
-	Debug                 bool   `long:"debug" description:"dump debug log for developer"`
-	SkipDuplicated        bool   `long:"skip-duplicated" description:"skip duplicated files"`
-	ShowLang              bool   `long:"show-lang" description:"print about all languages and extensions"`
-	ShowVersion           bool   `long:"version" description:"print version info"`
-	ShowTokenizerEncoding bool   `long:"show-encoding" description:"print about all LLM models and their corresponding encodings"`
-	TokenizerEncoding     string `long:"encoding" default:"cl100k_base" description:"specify tokenizer encoding" choice:"cl100k_base" choice:"p50k_base" choice:"p50k_edit" choice:"r50k_base"`
+	ByFile                bool          `long:"by-file" description:"report results for every encountered source file"`
+	SortTag               string        `long:"sort" default:"code" description:"sort based on a certain column" choice:"name" choice:"files" choice:"blank" choice:"comment" choice:"code" choice:"tokens"`
+	OutputType            string        `long:"output-type" default:"default" description:"output type [values: default,cloc-xml,sloccount,json]"`
+	ExcludeExt            string        `long:"exclude-ext" description:"exclude file name extensions (separated commas)"`
+	IncludeLang           string        `long:"include-lang" description:"include language name (separated commas)"`
+	Match                 string        `long:"match" description:"include file name (regex)"`
+	NotMatch              string        `long:"not-match" description:"exclude file name (regex)"`
+	MatchDir              string        `long:"match-d" description:"include dir name (regex)"`
+	NotMatchDir           string        `long:"not-match-d" description:"exclude dir name (regex)"`
+	Debug                 bool          `long:"debug" description:"dump debug log for developer"`
+	SkipDuplicated        bool          `long:"skip-duplicated" description:"skip duplicated files"`
+	Budget                int           `long:"budget" description:"pack mode: pick the files fitting within the token budget and report the included and excluded files"`
+	PackStrategy          string        `long:"pack-strategy" default:"size" description:"order in which the pack mode picks files, smallest first, by --priority patterns or most recently modified first" choice:"size" choice:"priority" choice:"recency"`
+	Priority              string        `long:"priority" description:"path, file name or directory patterns picked first by --pack-strategy=priority (separated commas)"`
+	Stream                bool          `long:"stream" description:"print the row of each file as soon as it is analyzed, unsorted (implies --by-file, default and json output types)"`
+	Diff                  bool          `long:"diff" description:"report the same, modified, added and removed counts between two directories or git revisions given as PATH arguments"`
+	Stdin                 bool          `long:"stdin" description:"read the source from stdin, same as the PATH -"`
+	StdinName             string        `long:"stdin-name" description:"file name of the source read from stdin, its language is detected from the name (default: stdin)"`
+	ForceLang             string        `long:"force-lang" description:"language of the source read from stdin (see --show-lang)"`
+	VCS                   string        `long:"vcs" description:"list the files to analyze from the version control system instead of walking the directories" choice:"git"`
+	Revision              string        `long:"revision" description:"analyze the files of a git revision or tree-ish (e.g. HEAD~10) without checking it out, implies --vcs=git"`
+	NoIgnore              bool          `long:"no-ignore" description:"do not skip files matched by .gitignore, .git/info/exclude and .ctocignore"`
+	ShowLang              bool          `long:"show-lang" description:"print about all languages and extensions"`
+	ShowVersion           bool          `long:"version" description:"print version info"`
+	ShowTokenizerEncoding bool          `long:"show-encoding" description:"print about all LLM models and their corresponding encodings"`
+	TokenizerEncoding     string        `long:"encoding" default:"cl100k_base" description:"specify tokenizer encodings, the first one is used for the token columns (separated commas) [values: cl100k_base,o200k_base,p50k_base,p50k_edit,r50k_base]"`
+	Model                 string        `long:"model" description:"specify tokenizer by LLM model name, instead of --encoding (see --show-encoding)"`
+	TokenizerFile         string        `long:"tokenizer-file" description:"specify tokenizer by a HuggingFace tokenizer.json file (BPE models), instead of --encoding, overrides --model"`
+	SpmModel              string        `long:"spm-model" description:"specify tokenizer by a SentencePiece .model file (unigram and BPE models), instead of --encoding, overrides --model"`
+	Estimate              bool          `long:"estimate" description:"estimate token counts from the text length per language instead of encoding it (fast, reports the error bound)"`
+	CacheDir              string        `long:"cache-dir" description:"directory of the cache of analyzed files (default: ctoc in the user cache directory)"`
+	NoCache               bool          `long:"no-cache" description:"analyze all files without reading or writing the cache"`
+	BpeDir                string        `long:"bpe-dir" description:"load tokenizer encodings from a local .tiktoken file or directory instead of downloading them"`
+	WholeFile             bool          `long:"whole-file" description:"tokenize the whole file content at once (counts newlines and merges across lines)"`
+	Jobs                  int           `long:"jobs" short:"j" description:"number of files to analyze in parallel (default: number of CPUs, always 1 with --debug)"`
+	Timeout               time.Duration `long:"timeout" description:"stop analyzing after the duration (e.g. 30s) and report the files analyzed before"`
+	Cost                  string        `long:"cost" description:"report the cost of sending the files as input tokens to the models (separated commas, see --show-prices)"`
+	PriceFile             string        `long:"price-file" description:"YAML or JSON file of the prices of the models in USD per million input tokens, overriding the built-in ones"`
+	ShowPrices            bool          `long:"show-prices" description:"print the prices of the models in USD per million input tokens"`
+}
+
+// encodings returns the encodings specified by --encoding, without duplicates.
+func (opts *CmdOptions) encodings() []string {
+	var encodings []string
+	seen := make(map[string]bool)
+	for _, encoding := range strings.Split(opts.TokenizerEncoding, ",") {
+		if encoding = strings.TrimSpace(encoding); encoding != "" && !seen[encoding] {
+			seen[encoding] = true
+			encodings = append(encodings, encoding)
+		}
+	}
+	return encodings
+}
+
+// cacheDir returns the cache directory specified by --cache-dir or the default one.
+func (opts *CmdOptions) cacheDir() (string, error) {
+	if opts.CacheDir != "" {
+		return opts.CacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ctoc"), nil
+}
+
+// cacheVersion returns the ctoc version for the cache, falling back to the
+// module version and VCS revision for builds without -ldflags.
+func cacheVersion() string {
+	version := Version + " " + GitCommit
+	if info, ok := debug.ReadBuildInfo(); ok && Version == "" {
+		version = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+				version += " " + setting.Value
+			}
+		}
+	}
+	return version
+}
+
+// extraEncodings returns the encodings reported side by side with the first one.
+func (opts *CmdOptions) extraEncodings() []string {
+	encodings := opts.encodings()
+	if opts.Estimate || opts.Model != "" || opts.TokenizerFile != "" || opts.SpmModel != "" || len(encodings) <= 1 {
+		return nil
+	}
+	return encodings[1:]
+}
+
+// costModels returns the models specified by --cost.
+func (opts *CmdOptions) costModels() []string {
+	var models []string
+	for _, model := range strings.Split(opts.Cost, ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// costEncodings returns the encodings of the --cost models which are counted in addition to the tokenizer and
+// the extra encodings, and the models of unknown encodings whose costs are estimated from the tokenizer counts.
+func (opts *CmdOptions) costEncodings(tokenizer string) (encodings []string, estimated []string) {
+	if opts.Estimate {
+		return nil, nil
+	}
+	counted := map[string]bool{tokenizer: true}
+	for _, encoding := range opts.extraEncodings() {
+		counted[encoding] = true
+	}
+	for _, model := range opts.costModels() {
+		encoding, err := ctoc.EncodingForModel(model)
+		if err != nil {
+			estimated = append(estimated, model)
+			continue
+		}
+		if !counted[encoding] {
+			counted[encoding] = true
+			encodings = append(encodings, encoding)
+		}
+	}
+	return encodings, estimated
+}
+
+// prices returns the built-in price table overridden by --price-file.
+func (opts *CmdOptions) prices() (ctoc.Prices, error) {
+	if opts.PriceFile == "" {
+		return ctoc.DefaultPrices(), nil
+	}
+	return ctoc.LoadPrices(opts.PriceFile)
+}
+
+// costColumnWidth returns the width of the cost column of the model.
+func costColumnWidth(model string) int {
+	if len(model) > 14 {
+		return len(model)
+	}
+	return 14
+}
+
+// extraColumns returns the token counts of the extra encodings, the error bound
+// of estimated token counts and the costs of --cost as default output columns.
+func (opts *CmdOptions) extraColumns(tokens ctoc.TokensByEncoding, tokensError int32, costs ctoc.CostByModel) string {
+	var sb strings.Builder
+	for _, encoding := range opts.extraEncodings() {
+		fmt.Fprintf(&sb, " %14v", tokens[encoding])
+	}
+	if opts.Estimate {
+		// "±" is 2 bytes wide
+		fmt.Fprintf(&sb, " %15s", fmt.Sprintf("±%d", tokensError))
+	}
+	for _, model := range opts.costModels() {
+		fmt.Fprintf(&sb, " %[1]*[2]s", costColumnWidth(model), fmt.Sprintf("$%.6f", costs[model]))
+	}
+	return sb.String()
 }
 
 type outputBuilder struct {
@@ -72,20 +218,43 @@ func newOutputBuilder(result *ctoc.Result, opts *CmdOptions) *outputBuilder {
 	}
 }
 
+// columns returns the header of the count columns followed by the extra columns.
+func (o *outputBuilder) columns() string {
+	columns := commonHeader
+	for _, encoding := range o.opts.extraEncodings() {
+		columns += fmt.Sprintf(" %14s", encoding)
+	}
+	if o.opts.Estimate {
+		columns += fmt.Sprintf(" %14s", "tokens-error")
+	}
+	for _, model := range o.opts.costModels() {
+		columns += fmt.Sprintf(" %[1]*[2]s", costColumnWidth(model), model)
+	}
+	return columns
+}
+
+// headerLen returns the width of the language or file column.
+func (o *outputBuilder) headerLen() int {
+	if o.opts.ByFile {
+		return o.result.MaxPathLength + 1
+	}
+	return 28
+}
+
+// rowLen returns the width of the rows, which is the width of the separators.
+func (o *outputBuilder) rowLen() int {
+	return o.headerLen() + 1 + len(o.columns())
+}
+
 func (o *outputBuilder) WriteHeader() {
-	maxPathLen := o.result.MaxPathLength
-	headerLen := 28
 	header := languageHeader
-
 	if o.opts.ByFile {
-		headerLen = maxPathLen + 1
-		rowLen = maxPathLen + len(commonHeader) + 2
 		header = fileHeader
 	}
 	if o.opts.OutputType == OutputTypeDefault {
-		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, rowLen)
-		fmt.Printf("%-[2]*[1]s %[3]s\n", header, headerLen, commonHeader)
-		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, rowLen)
+		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, o.rowLen())
+		fmt.Printf("%-[2]*[1]s %[3]s\n", header, o.headerLen(), o.columns())
+		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, o.rowLen())
 	}
 }
 
@@ -94,15 +263,19 @@ func (o *outputBuilder) WriteFooter() {
 	maxPathLen := o.result.MaxPathLength
 
 	if o.opts.OutputType == OutputTypeDefault {
-		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, rowLen)
+		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, o.rowLen())
 		if o.opts.ByFile {
-			fmt.Printf("%-[1]*[2]v %6[3]v %14[4]v %14[5]v %14[6]v %14[7]v\n",
-				maxPathLen, "TOTAL", total.Total, total.Blanks, total.Comments, total.Code, total.Tokens)
+			fmt.Printf("%-[1]*[2]v %6[3]v %14[4]v %14[5]v %14[6]v %14[7]v %14[8]v %14[9]v %14[10]v%[11]s\n",
+				maxPathLen, "TOTAL", total.Total, total.Blanks, total.Comments, total.Code, total.Tokens,
+				total.CodeTokens, total.CommentTokens, total.BlankTokens,
+				o.opts.extraColumns(total.EncodingTokens, total.TokensError, total.Costs))
 		} else {
-			fmt.Printf("%-27v %6v %14v %14v %14v %14v\n",
-				"TOTAL", total.Total, total.Blanks, total.Comments, total.Code, total.Tokens)
+			fmt.Printf("%-27v %6v %14v %14v %14v %14v %14v %14v %14v%s\n",
+				"TOTAL", total.Total, total.Blanks, total.Comments, total.Code, total.Tokens,
+				total.CodeTokens, total.CommentTokens, total.BlankTokens,
+				o.opts.extraColumns(total.EncodingTokens, total.TokensError, total.Costs))
 		}
-		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, rowLen)
+		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, o.rowLen())
 	}
 }
 
@@ -134,13 +307,24 @@ func writeResultWithByFile(opts *CmdOptions, result *ctoc.Result) {
 			Code:    total.Code,
 			Comment: total.Comments,
 			Blank:   total.Blanks,
+			Tokens:  total.Tokens,
+
+			CodeTokens:    total.CodeTokens,
+			CommentTokens: total.CommentTokens,
+			BlankTokens:   total.BlankTokens,
+			TokensError:   total.TokensError,
+
+			EncodingTokens: total.EncodingTokens,
+			Costs:          total.Costs,
 		}
 		f := &ctoc.XMLResultFiles{
 			Files: sortedFiles,
 			Total: t,
 		}
 		xmlResult := ctoc.XMLResult{
-			XMLFiles: f,
+			Model:      opts.Model,
+			Incomplete: result.Incomplete,
+			XMLFiles:   f,
 		}
 		xmlResult.Encode()
 	case OutputTypeSloccount:
@@ -157,6 +341,8 @@ func writeResultWithByFile(opts *CmdOptions, result *ctoc.Result) {
 		}
 	case OutputTypeJSON:
 		jsonResult := ctoc.NewJSONFilesResultFromCloc(total, sortedFiles)
+		jsonResult.Model = opts.Model
+		jsonResult.Incomplete = result.Incomplete
 		buf, err := json.Marshal(jsonResult)
 		if err != nil {
 			fmt.Println(err)
@@ -166,12 +352,18 @@ func writeResultWithByFile(opts *CmdOptions, result *ctoc.Result) {
 	default:
 		for _, file := range sortedFiles {
 			clocFile := file
-			fmt.Printf("%-[1]*[2]s %21[3]v %14[4]v %14[5]v %14[6]v\n",
-				maxPathLen, file.Name, clocFile.Blanks, clocFile.Comments, clocFile.Code, clocFile.Tokens)
+			writeFileRow(opts, &clocFile, maxPathLen)
 		}
 	}
 }
 
+func writeFileRow(opts *CmdOptions, clocFile *ctoc.ClocFile, maxPathLen int) {
+	fmt.Printf("%-[1]*[2]s %21[3]v %14[4]v %14[5]v %14[6]v %14[7]v %14[8]v %14[9]v%[10]s\n",
+		maxPathLen, clocFile.Name, clocFile.Blanks, clocFile.Comments, clocFile.Code, clocFile.Tokens,
+		clocFile.CodeTokens, clocFile.CommentTokens, clocFile.BlankTokens,
+		opts.extraColumns(clocFile.EncodingTokens, clocFile.TokensError, clocFile.Costs))
+}
+
 func (o *outputBuilder) WriteResult() {
 	// write header
 	o.WriteHeader()
@@ -206,9 +398,13 @@ func (o *outputBuilder) WriteResult() {
 		switch o.opts.OutputType {
 		case OutputTypeClocXML:
 			xmlResult := ctoc.NewXMLResultFromCloc(total, sortedLanguages, ctoc.XMLResultWithLangs)
+			xmlResult.Model = o.opts.Model
+			xmlResult.Incomplete = o.result.Incomplete
 			xmlResult.Encode()
 		case OutputTypeJSON:
 			jsonResult := ctoc.NewJSONLanguagesResultFromCloc(total, sortedLanguages)
+			jsonResult.Model = o.opts.Model
+			jsonResult.Incomplete = o.result.Incomplete
 			buf, err := json.Marshal(jsonResult)
 			if err != nil {
 				fmt.Println(err)
@@ -217,8 +413,10 @@ func (o *outputBuilder) WriteResult() {
 			os.Stdout.Write(buf)
 		default:
 			for _, language := range sortedLanguages {
-				fmt.Printf("%-27v %6v %14v %14v %14v %14v\n",
-					language.Name, len(language.Files), language.Blanks, language.Comments, language.Code, language.Tokens)
+				fmt.Printf("%-27v %6v %14v %14v %14v %14v %14v %14v %14v%s\n",
+					language.Name, len(language.Files), language.Blanks, language.Comments, language.Code, language.Tokens,
+					language.CodeTokens, language.CommentTokens, language.BlankTokens,
+					o.opts.extraColumns(language.EncodingTokens, language.TokensError, language.Costs))
 			}
 		}
 	}
@@ -229,13 +427,29 @@ func (o *outputBuilder) WriteResult() {
 
 func main() {
 	var opts CmdOptions
-	clocOpts := ctoc.NewClocOptions()
 	// parse command line options
+	var bundleOpts BundleCommand
+	var chunkOpts ChunkCommand
 	parser := flags.NewParser(&opts, flags.Default)
 	parser.Name = "ctoc"
 	parser.Usage = "[OPTIONS] PATH[...]"
+	parser.SubcommandsOptional = true
+	bundleCmd, err := parser.AddCommand("bundle", "write the files into one document for a prompt",
+		"Write the files to analyze into one document for a prompt, with a header for each file, "+
+			"and report the token count of the document.", &bundleOpts)
+	if err != nil {
+		panic(err)
+	}
+	bundleCmd.ArgsRequired = false
+	chunkCmd, err := parser.AddCommand("chunk", "split the files into chunks bounded by tokens",
+		"Split the files to analyze into chunks of at most --max-tokens tokens at line boundaries, "+
+			"preferably after a blank line or before a comment block, and write them as JSON Lines.", &chunkOpts)
+	if err != nil {
+		panic(err)
+	}
+	chunkCmd.ArgsRequired = false
 
-	paths, err := flags.Parse(&opts)
+	paths, err := parser.Parse()
 	if err != nil {
 		return
 	}
@@ -254,13 +468,66 @@ func main() {
 	}
 
 	if opts.ShowTokenizerEncoding {
-		for m, tke := range tiktoken.MODEL_TO_ENCODING {
-			fmt.Printf(fmt.Sprintf("%-30v (%s)\n", m, tke))
+		modelEncodings := ctoc.ModelEncodings()
+		models := make([]string, 0, len(modelEncodings))
+		for m := range modelEncodings {
+			models = append(models, m)
+		}
+		sort.Strings(models)
+		for _, m := range models {
+			fmt.Printf("%-30v (%s)\n", m, modelEncodings[m])
+		}
+		return
+	}
+
+	prices, err := opts.prices()
+	if err != nil {
+		fmt.Printf("failed to load prices. error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.ShowPrices {
+		models := make([]string, 0, len(prices))
+		for m := range prices {
+			models = append(models, m)
+		}
+		sort.Strings(models)
+		for _, m := range models {
+			fmt.Printf("%-30v $%v\n", m, prices[m])
 		}
 		return
 	}
+	for _, model := range opts.costModels() {
+		if _, err := prices.Price(model); err != nil {
+			fmt.Printf("`--cost` option requires models with a price (see --show-prices or --price-file). error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	if len(paths) <= 0 {
+	known := make(map[string]bool)
+	for _, encoding := range ctoc.Encodings() {
+		known[encoding] = true
+	}
+	for _, encoding := range opts.encodings() {
+		if !known[encoding] {
+			fmt.Printf("`--encoding` option requires known encodings [values: %s]. error: unknown encoding %s\n",
+				strings.Join(ctoc.Encodings(), ","), encoding)
+			os.Exit(1)
+		}
+	}
+	if encoding := parser.FindOptionByLongName("encoding"); encoding.IsSet() && !encoding.IsSetDefault() && (opts.Model != "" || opts.TokenizerFile != "" || opts.SpmModel != "") {
+		fmt.Println("`--encoding` option cannot be used in conjunction with the `--model`, `--tokenizer-file` or `--spm-model` option")
+		os.Exit(1)
+	}
+
+	stdin := opts.Stdin
+	for _, path := range paths {
+		stdin = stdin || path == "-"
+	}
+	if stdin && len(paths) > 0 && !(len(paths) == 1 && paths[0] == "-") {
+		fmt.Println("`--stdin` option and the PATH `-` cannot be used in conjunction with other PATH arguments")
+		os.Exit(1)
+	}
+	if len(paths) <= 0 && !stdin {
 		parser.WriteHelp(os.Stdout)
 		return
 	}
@@ -270,6 +537,19 @@ func main() {
 		fmt.Println("`--sort files` option cannot be used in conjunction with the `--by-file` option")
 		os.Exit(1)
 	}
+	if opts.Budget < 0 || opts.Budget > math.MaxInt32 {
+		fmt.Printf("`--budget` option requires a number of tokens from 1 to %d\n", math.MaxInt32)
+		os.Exit(1)
+	}
+	if opts.Stream && opts.Budget > 0 {
+		fmt.Println("`--stream` option cannot be used in conjunction with the `--budget` option")
+		os.Exit(1)
+	}
+
+	if opts.BpeDir != "" {
+		ctoc.SetBpePath(opts.BpeDir)
+	}
+	clocOpts := ctoc.NewClocOptions()
 
 	// setup option for exclude extensions
 	for _, ext := range strings.Split(opts.ExcludeExt, ",") {
@@ -304,20 +584,150 @@ func main() {
 
 	clocOpts.Debug = opts.Debug
 	clocOpts.SkipDuplicated = opts.SkipDuplicated
-	tke, err := tiktoken.GetEncoding(opts.TokenizerEncoding)
+	clocOpts.WholeFile = opts.WholeFile
+	clocOpts.NoIgnore = opts.NoIgnore
+	clocOpts.VCS = opts.VCS
+	clocOpts.Revision = opts.Revision
+	if clocOpts.Revision != "" {
+		clocOpts.VCS = "git"
+	}
+	clocOpts.Jobs = opts.Jobs
+	if opts.Debug {
+		// the debug log of the files analyzed in parallel would be interleaved
+		clocOpts.Jobs = 1
+	} else if clocOpts.Jobs <= 0 {
+		clocOpts.Jobs = runtime.NumCPU()
+	}
+	var tke ctoc.Tokenizer
+	switch encodings := opts.encodings(); {
+	case opts.Estimate:
+		tke = ctoc.NewEstimator()
+	case opts.TokenizerFile != "":
+		tke, err = ctoc.NewHFTokenizer(opts.TokenizerFile)
+	case opts.SpmModel != "":
+		tke, err = ctoc.NewSentencePieceTokenizer(opts.SpmModel)
+	case opts.Model != "":
+		tke, err = ctoc.TokenizerForModel(opts.Model)
+	case len(encodings) > 0:
+		tke, err = ctoc.NewTiktokenTokenizer(encodings[0])
+	default:
+		err = fmt.Errorf("no encoding specified")
+	}
 	if err != nil {
 		fmt.Printf("failed to initialize tokenizer. error: %v\n", err)
 		return
 	}
 	clocOpts.Tokenizer = tke
+	for _, encoding := range opts.extraEncodings() {
+		extra, err := ctoc.NewTiktokenTokenizer(encoding)
+		if err != nil {
+			fmt.Printf("failed to initialize tokenizer. error: %v\n", err)
+			return
+		}
+		clocOpts.Tokenizers = append(clocOpts.Tokenizers, extra)
+	}
+	encodings, estimated := opts.costEncodings(tke.Name())
+	for _, encoding := range encodings {
+		extra, err := ctoc.NewTiktokenTokenizer(encoding)
+		if err != nil {
+			fmt.Printf("failed to initialize tokenizer. error: %v\n", err)
+			return
+		}
+		clocOpts.Tokenizers = append(clocOpts.Tokenizers, extra)
+	}
+	for _, model := range estimated {
+		fmt.Fprintf(os.Stderr, "the encoding of %s is unknown, its cost is estimated from the %s token counts\n", model, tke.Name())
+	}
+
+	if !opts.NoCache {
+		dir, err := opts.cacheDir()
+		if err == nil {
+			clocOpts.Cache, err = ctoc.OpenCache(dir, cacheVersion())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open cache, analyzing without cache. error: %v\n", err)
+		}
+	}
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	if opts.Diff {
+		if len(paths) != 2 {
+			fmt.Println("`--diff` option requires two directories or git revisions to compare")
+			os.Exit(1)
+		}
+		diff, err := analyzeDiff(ctx, languages, clocOpts, paths[0], paths[1])
+		if err != nil {
+			fmt.Printf("fail ctoc analyze. error: %v\n", err)
+			return
+		}
+		writeDiffResult(&opts, diff)
+		return
+	}
 
 	processor := ctoc.NewProcessor(languages, clocOpts)
-	result, err := processor.Analyze(paths)
-	if err != nil {
+	if parser.Active == bundleCmd {
+		if err := writeBundle(processor, paths, &opts, &bundleOpts); err != nil {
+			fmt.Printf("fail ctoc bundle. error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if parser.Active == chunkCmd {
+		if err := writeChunks(processor, paths, &chunkOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "fail ctoc chunk. error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if opts.Stream && !stdin {
+		opts.ByFile = true
+		if err := writeStreamResult(ctx, processor, paths, &opts, prices); err != nil {
+			if ctx.Err() != nil {
+				fmt.Fprintf(os.Stderr, "analysis interrupted, the result is incomplete. error: %v\n", err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "fail ctoc stream. error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var result *ctoc.Result
+	if stdin {
+		name := opts.StdinName
+		if name == "" {
+			name = "stdin"
+		}
+		result, err = processor.AnalyzeReaderContext(ctx, name, opts.ForceLang, os.Stdin)
+	} else {
+		result, err = processor.AnalyzeContext(ctx, paths)
+	}
+	if err != nil && (result == nil || !result.Incomplete) {
 		fmt.Printf("fail ctoc analyze. error: %v\n", err)
 		return
 	}
+	if err := result.AddCosts(prices, opts.costModels()); err != nil {
+		fmt.Printf("fail ctoc cost. error: %v\n", err)
+		return
+	}
 
-	builder := newOutputBuilder(result, &opts)
-	builder.WriteResult()
+	if opts.Budget > 0 {
+		if err := writePackResult(result, paths, &opts); err != nil {
+			fmt.Printf("fail ctoc pack. error: %v\n", err)
+			return
+		}
+	} else {
+		builder := newOutputBuilder(result, &opts)
+		builder.WriteResult()
+	}
+	if result.Incomplete {
+		fmt.Fprintf(os.Stderr, "analysis interrupted, the result is incomplete. error: %v\n", err)
+	}
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yaohui-wyh/ctoc"
+)
+
+// writePackResult picks the files of result fitting within --budget and prints the included and excluded files.
+func writePackResult(result *ctoc.Result, paths []string, opts *CmdOptions) error {
+	packOpts := ctoc.PackOptions{
+		Budget:   int32(opts.Budget),
+		Strategy: ctoc.PackStrategy(opts.PackStrategy),
+		Roots:    paths,
+	}
+	for _, pattern := range strings.Split(opts.Priority, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			packOpts.Priority = append(packOpts.Priority, pattern)
+		}
+	}
+	pack, err := ctoc.Pack(result, packOpts)
+	if err != nil {
+		return err
+	}
+
+	switch opts.OutputType {
+	case OutputTypeClocXML:
+		output, err := xml.MarshalIndent(pack, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf(xml.Header)
+		fmt.Println(string(output))
+	case OutputTypeJSON:
+		buf, err := json.Marshal(pack)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(buf)
+	default:
+		nameLen := result.MaxPathLength
+		if nameLen < len("Excluded") {
+			nameLen = len("Excluded")
+		}
+		packRowLen := nameLen + 15
+		writeFiles := func(header string, files ctoc.ClocFiles) {
+			fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, packRowLen)
+			fmt.Printf("%-[1]*[2]s %14[3]s\n", nameLen, header, "tokens")
+			fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, packRowLen)
+			for _, file := range files {
+				fmt.Printf("%-[1]*[2]s %14[3]v\n", nameLen, file.Name, file.Tokens)
+			}
+		}
+		writeFiles("Included", pack.Included)
+		writeFiles("Excluded", pack.Excluded)
+		fmt.Printf("%.[2]*[1]s\n", defaultOutputSeparator, packRowLen)
+		fmt.Printf("budget: %v, tokens: %v, headroom: %v, files: %v included, %v excluded\n",
+			pack.Budget, pack.Tokens, pack.Headroom, len(pack.Included), len(pack.Excluded))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/yaohui-wyh/ctoc"
+)
+
+// streamPathLength is the width of the file column of --stream, longer paths are not aligned.
+const streamPathLength = 40
+
+// writeStreamResult prints the row of each file as soon as it is analyzed, followed by the total
+// in the default output type, or each file as a line of JSON in the json output type.
+func writeStreamResult(ctx context.Context, processor *ctoc.Processor, paths []string, opts *CmdOptions, prices ctoc.Prices) error {
+	models := opts.costModels()
+	if opts.OutputType == OutputTypeJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		return processor.WalkContext(ctx, paths, func(file *ctoc.ClocFile) error {
+			if len(models) > 0 {
+				file.Costs = prices.Costs(models, file.Tokens, file.EncodingTokens)
+			}
+			return encoder.Encode(file)
+		})
+	}
+
+	total := ctoc.NewLanguage("TOTAL", []string{}, [][]string{{"", ""}})
+	total.EncodingTokens = ctoc.TokensByEncoding{}
+	builder := newOutputBuilder(&ctoc.Result{Total: total, MaxPathLength: streamPathLength}, opts)
+	builder.WriteHeader()
+	err := processor.WalkContext(ctx, paths, func(file *ctoc.ClocFile) error {
+		file.Costs = prices.Costs(models, file.Tokens, file.EncodingTokens)
+		writeFileRow(opts, file, streamPathLength)
+		total.Total++
+		total.Code += file.Code
+		total.Comments += file.Comments
+		total.Blanks += file.Blanks
+		total.Tokens += file.Tokens
+		total.CodeTokens += file.CodeTokens
+		total.CommentTokens += file.CommentTokens
+		total.BlankTokens += file.BlankTokens
+		total.TokensError += file.TokensError
+		for encoding, tokens := range file.EncodingTokens {
+			total.EncodingTokens[encoding] += tokens
+		}
+		return nil
+	})
+	total.Costs = prices.Costs(models, total.Tokens, total.EncodingTokens)
+	builder.WriteFooter()
+	return err
+}
@@ -0,0 +1,144 @@
+package ctoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Prices is the price table of the input tokens of the models in USD per million tokens, keyed by model name.
+type Prices map[string]float64
+
+// defaultPrices is the published price of the input tokens of the models in USD per million tokens.
+var defaultPrices = Prices{
+	"gpt-3.5-turbo":          0.50,
+	"gpt-4":                  30.00,
+	"gpt-4-turbo":            10.00,
+	"gpt-4o":                 2.50,
+	"gpt-4o-mini":            0.15,
+	"gpt-4.1":                2.00,
+	"gpt-4.1-mini":           0.40,
+	"gpt-4.1-nano":           0.10,
+	"gpt-4.5":                75.00,
+	"o1":                     15.00,
+	"o1-mini":                1.10,
+	"o3-mini":                1.10,
+	"text-embedding-3-large": 0.13,
+	"text-embedding-3-small": 0.02,
+	"text-embedding-ada-002": 0.10,
+}
+
+// DefaultPrices returns the built-in price table.
+func DefaultPrices() Prices {
+	prices := make(Prices, len(defaultPrices))
+	for model, price := range defaultPrices {
+		prices[model] = price
+	}
+	return prices
+}
+
+// LoadPrices returns the built-in price table overridden by the prices in the YAML or JSON file,
+// which maps model names to the prices in USD per million input tokens, e.g. "gpt-4o: 2.5".
+func LoadPrices(filename string) (Prices, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides Prices
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		err = json.Unmarshal(content, &overrides)
+	} else {
+		err = yaml.Unmarshal(content, &overrides)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	prices := DefaultPrices()
+	for model, price := range overrides {
+		if price < 0 {
+			return nil, fmt.Errorf("%s: invalid price of %s: %v", filename, model, price)
+		}
+		prices[model] = price
+	}
+	return prices, nil
+}
+
+// Price returns the price of the model in USD per million input tokens, model names are
+// matched exactly first and then by the longest model name followed by "-" (e.g. gpt-4o-2024-08-06).
+func (p Prices) Price(model string) (float64, error) {
+	if price, ok := p[model]; ok {
+		return price, nil
+	}
+
+	var prefix string
+	for name := range p {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(prefix) {
+			prefix = name
+		}
+	}
+	if prefix == "" {
+		return 0, fmt.Errorf("unknown price of model: %s", model)
+	}
+	return p[prefix], nil
+}
+
+// Costs returns the cost of the tokens for each model, models without a price are skipped.
+// The token count of the encoding of a model is used when it is in encodingTokens, tokens otherwise,
+// so the encodings of the models should be counted by ClocOptions.Tokenizers unless tokens is counted by it.
+func (p Prices) Costs(models []string, tokens int32, encodingTokens TokensByEncoding) CostByModel {
+	costs := make(CostByModel, len(models))
+	for _, model := range models {
+		price, err := p.Price(model)
+		if err != nil {
+			continue
+		}
+		n := tokens
+		if encoding, err := EncodingForModel(model); err == nil {
+			if encTokens, ok := encodingTokens[encoding]; ok {
+				n = encTokens
+			}
+		}
+		// rounded to micro dollars to drop the floating point noise
+		costs[model] = math.Round(float64(n)*price) / 1e6
+	}
+	return costs
+}
+
+// CostByModel is the costs in USD keyed by model name.
+type CostByModel map[string]float64
+
+// Names returns the model names in sorted order.
+func (c CostByModel) Names() []string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddCosts sets the costs of sending the files, the languages and the total of the result to the models.
+func (r *Result) AddCosts(prices Prices, models []string) error {
+	for _, model := range models {
+		if _, err := prices.Price(model); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range r.Files {
+		file.Costs = prices.Costs(models, file.Tokens, file.EncodingTokens)
+	}
+	for _, language := range r.Languages {
+		language.Costs = prices.Costs(models, language.Tokens, language.EncodingTokens)
+	}
+	r.Total.Costs = prices.Costs(models, r.Total.Tokens, r.Total.EncodingTokens)
+	return nil
+}
@@ -0,0 +1,95 @@
+package ctoc
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPricesPrice(t *testing.T) {
+	prices := Prices{"gpt-4o": 2.5, "gpt-4o-mini": 0.15, "gpt-4": 30}
+	tests := []struct {
+		model    string
+		expected float64
+	}{
+		{"gpt-4o", 2.5},
+		{"gpt-4o-2024-08-06", 2.5},
+		{"gpt-4o-mini-2024-07-18", 0.15},
+		{"gpt-4-0613", 30},
+	}
+	for _, test := range tests {
+		price, err := prices.Price(test.model)
+		if err != nil {
+			t.Fatalf("Price() error. model=%v err=[%v]", test.model, err)
+		}
+		if price != test.expected {
+			t.Errorf("invalid price. model=%v price=%v", test.model, price)
+		}
+	}
+	for _, model := range []string{"gpt-4o2", "claude", ""} {
+		if _, err := prices.Price(model); err == nil {
+			t.Errorf("invalid logic. expected error for model %q", model)
+		}
+	}
+}
+
+func TestLoadPrices(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"prices.yaml":    "# negotiated prices\ngpt-4o: 2.0\nmy-model: 1\n",
+		"prices.json":    `{"gpt-4o": 2.0, "my-model": 1}`,
+		"negative.yml":   "gpt-4o: -1\n",
+		"broken.json":    "gpt-4o: 2.0\n",
+		"not-a-map.yaml": "- gpt-4o\n",
+	})
+
+	for _, name := range []string{"prices.yaml", "prices.json"} {
+		prices, err := LoadPrices(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("LoadPrices() error. name=%v err=[%v]", name, err)
+		}
+		if prices["gpt-4o"] != 2.0 || prices["my-model"] != 1 || prices["gpt-4o-mini"] != DefaultPrices()["gpt-4o-mini"] {
+			t.Errorf("invalid prices. name=%v prices=%v", name, prices)
+		}
+	}
+	if DefaultPrices()["gpt-4o"] != 2.5 {
+		t.Errorf("invalid logic. default prices are overridden")
+	}
+
+	for _, name := range []string{"negative.yml", "broken.json", "not-a-map.yaml", "missing.yaml"} {
+		if _, err := LoadPrices(filepath.Join(dir, name)); err == nil {
+			t.Errorf("invalid logic. expected error for %v", name)
+		}
+	}
+}
+
+func TestResultAddCosts(t *testing.T) {
+	prices := Prices{"gpt-4": 30, "gpt-4o": 2.5}
+	file := &ClocFile{Name: "main.go", Tokens: 1000, EncodingTokens: TokensByEncoding{"cl100k_base": 1000, "o200k_base": 800}}
+	language := &Language{Name: "Go", Tokens: 1000, EncodingTokens: TokensByEncoding{"cl100k_base": 1000, "o200k_base": 800}}
+	total := &Language{Tokens: 3}
+	result := &Result{
+		Total:     total,
+		Files:     map[string]*ClocFile{file.Name: file},
+		Languages: map[string]*Language{language.Name: language},
+	}
+
+	if err := result.AddCosts(prices, []string{"gpt-4", "gpt-4o"}); err != nil {
+		t.Fatalf("AddCosts() error. err=[%v]", err)
+	}
+	// gpt-4o uses the token count of its encoding o200k_base
+	expected := CostByModel{"gpt-4": 0.03, "gpt-4o": 0.002}
+	if !reflect.DeepEqual(file.Costs, expected) || !reflect.DeepEqual(language.Costs, expected) {
+		t.Errorf("invalid costs. file=%v language=%v", file.Costs, language.Costs)
+	}
+	if expected := (CostByModel{"gpt-4": 0.00009, "gpt-4o": 0.000008}); !reflect.DeepEqual(total.Costs, expected) {
+		t.Errorf("invalid costs. total=%v", total.Costs)
+	}
+	if names := total.Costs.Names(); !reflect.DeepEqual(names, []string{"gpt-4", "gpt-4o"}) {
+		t.Errorf("invalid names. names=%v", names)
+	}
+
+	if err := result.AddCosts(prices, []string{"unknown"}); err == nil {
+		t.Errorf("invalid logic. expected error for unknown model")
+	}
+}
@@ -0,0 +1,348 @@
+package ctoc
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// DiffCount is the change of a count between two results, in the manner of cloc --diff.
+type DiffCount struct {
+	Same     int32 `xml:"same,attr" json:"same"`
+	Modified int32 `xml:"modified,attr" json:"modified"`
+	Added    int32 `xml:"added,attr" json:"added"`
+	Removed  int32 `xml:"removed,attr" json:"removed"`
+}
+
+// DiffStat is the change of the counts of a file, a language or the total between two results.
+type DiffStat struct {
+	Name     string    `xml:"name,attr" json:"name"`
+	Lang     string    `xml:"language,attr,omitempty" json:"language,omitempty"`
+	Files    DiffCount `xml:"files" json:"files"`
+	Blanks   DiffCount `xml:"blank" json:"blank"`
+	Comments DiffCount `xml:"comment" json:"comment"`
+	Code     DiffCount `xml:"code" json:"code"`
+	Tokens   DiffCount `xml:"tokens" json:"tokens"`
+}
+
+// DiffStats is a list of DiffStat.
+type DiffStats []DiffStat
+
+// SortByName sorts the stats by name.
+func (ds DiffStats) SortByName() {
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].Name < ds[j].Name
+	})
+}
+
+// DiffResult is the change between two results, files are matched by the path relative to their root.
+type DiffResult struct {
+	Total     *DiffStat
+	Files     map[string]*DiffStat
+	Languages map[string]*DiffStat
+}
+
+// Diff compares the result of the files under fromRoot with the result of the files under toRoot.
+//
+// The counts of a file only in from are removed and the counts of a file only in to are added.
+// A file in both with an identical content is the same, otherwise its lines of each kind are compared
+// in the manner of cloc: the unchanged lines are the same, and in each run of changed lines the
+// removed lines paired with added lines are modified and the others are removed or added.
+// The tokens of the same, modified and added lines are counted in the new file, those of the removed lines in the old file.
+// When the files are tokenized as a whole (WholeFile), the smaller of the old and new token counts of a changed file
+// is modified and the difference is added or removed.
+// A file whose language changed is removed from the old language and added to the new one.
+//
+// Only the counts of a file are compared when it can not be read again, e.g. in a Result which is not
+// returned by Processor. Both results should be analyzed with SkipDuplicated, otherwise a file dropped as
+// a duplicate on one side only is reported as added or removed.
+func Diff(from *Result, fromRoot string, to *Result, toRoot string) *DiffResult {
+	fromFiles := relativeFiles(from, fromRoot)
+	toFiles := relativeFiles(to, toRoot)
+
+	diff := &DiffResult{
+		Total:     &DiffStat{Name: "TOTAL"},
+		Files:     make(map[string]*DiffStat),
+		Languages: make(map[string]*DiffStat),
+	}
+	for name, fromFile := range fromFiles {
+		diff.add(name, from, fromFile, to, toFiles[name])
+	}
+	for name, toFile := range toFiles {
+		if _, ok := fromFiles[name]; !ok {
+			diff.add(name, from, nil, to, toFile)
+		}
+	}
+	return diff
+}
+
+func relativeFiles(result *Result, root string) map[string]*ClocFile {
+	files := make(map[string]*ClocFile, len(result.Files))
+	for name, file := range result.Files {
+		if rel, err := filepath.Rel(root, name); err == nil {
+			name = rel
+		}
+		files[filepath.ToSlash(name)] = file
+	}
+	return files
+}
+
+func (d *DiffResult) add(name string, fromResult *Result, from *ClocFile, toResult *Result, to *ClocFile) {
+	var stat DiffStat
+	switch {
+	case to == nil:
+		stat = removedStat(from)
+	case from == nil:
+		stat = addedStat(to)
+	case from.Lang != to.Lang:
+		// the file is reported in the new language, with both its removal and its addition
+		removed := removedStat(from)
+		d.addLanguage(&removed)
+		stat = addedStat(to)
+		d.addLanguage(&stat)
+		stat.add(&removed)
+		stat.Name = name
+		d.Files[name] = &stat
+		d.Total.add(&stat)
+		return
+	default:
+		stat = diffFile(fromResult, from, toResult, to)
+	}
+	stat.Name = name
+	d.Files[name] = &stat
+	d.addLanguage(&stat)
+	d.Total.add(&stat)
+}
+
+func (d *DiffResult) addLanguage(stat *DiffStat) {
+	language, ok := d.Languages[stat.Lang]
+	if !ok {
+		language = &DiffStat{Name: stat.Lang}
+		d.Languages[stat.Lang] = language
+	}
+	language.add(stat)
+}
+
+func removedStat(file *ClocFile) DiffStat {
+	return DiffStat{
+		Lang:     file.Lang,
+		Files:    DiffCount{Removed: 1},
+		Blanks:   DiffCount{Removed: file.Blanks},
+		Comments: DiffCount{Removed: file.Comments},
+		Code:     DiffCount{Removed: file.Code},
+		Tokens:   DiffCount{Removed: file.Tokens},
+	}
+}
+
+func addedStat(file *ClocFile) DiffStat {
+	return DiffStat{
+		Lang:     file.Lang,
+		Files:    DiffCount{Added: 1},
+		Blanks:   DiffCount{Added: file.Blanks},
+		Comments: DiffCount{Added: file.Comments},
+		Code:     DiffCount{Added: file.Code},
+		Tokens:   DiffCount{Added: file.Tokens},
+	}
+}
+
+// diffFile returns the change of a file in both results, by comparing its contents and its lines.
+func diffFile(fromResult *Result, from *ClocFile, toResult *Result, to *ClocFile) DiffStat {
+	fromContent, fromLines, fromErr := fromResult.fileLines(from)
+	toContent, toLines, toErr := toResult.fileLines(to)
+	if fromErr != nil || toErr != nil {
+		return diffCounts(from, to)
+	}
+	if bytes.Equal(fromContent, toContent) {
+		return sameStat(to)
+	}
+
+	stat := DiffStat{Lang: to.Lang, Files: DiffCount{Modified: 1}}
+	for kind, count := range map[lineKind]*DiffCount{lineBlank: &stat.Blanks, lineComment: &stat.Comments, lineCode: &stat.Code} {
+		diffLines(linesOfKind(fromLines, kind), linesOfKind(toLines, kind), count, &stat.Tokens)
+	}
+	// the token counts of the lines do not add up to the count of the whole file
+	if fromResult.opts.WholeFile || toResult.opts.WholeFile {
+		stat.Tokens = modifiedCount(from.Tokens, to.Tokens)
+	}
+	return stat
+}
+
+// fileLines reads the analyzed file again and returns its content and its lines.
+func (r *Result) fileLines(file *ClocFile) ([]byte, []chunkLine, error) {
+	language := r.Languages[file.Lang]
+	if r.opts == nil || language == nil {
+		return nil, nil, fmt.Errorf("%s: the file can not be read again", file.Name)
+	}
+	content, err := r.opts.readFile(file.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the lines are read completely even if the analysis was interrupted
+	lineOpts := *r.opts
+	lineOpts.ctx = nil
+	return content, scanLines(file.Name, language, bytes.NewReader(content), &lineOpts), nil
+}
+
+func linesOfKind(lines []chunkLine, kind lineKind) []chunkLine {
+	var filtered []chunkLine
+	for _, line := range lines {
+		if line.kind == kind {
+			filtered = append(filtered, line)
+		}
+	}
+	return filtered
+}
+
+// maxDiffCells is the maximum size of the table of diffLines, the changed lines of larger files
+// are compared as a single run.
+const maxDiffCells = 1 << 22
+
+// diffLines compares the lines by their longest common subsequence and adds the line counts to count
+// and the token counts to tokens. The blank lines are all equal, so their difference is only their number.
+func diffLines(from, to []chunkLine, count, tokens *DiffCount) {
+	equal := func(i, j int) bool {
+		return from[i].kind == lineBlank || from[i].text == to[j].text
+	}
+	same := func(line chunkLine) {
+		count.Same++
+		tokens.Same += line.tokens
+	}
+	changed := func(removed, added []chunkLine) {
+		for i, line := range added {
+			if i < len(removed) {
+				count.Modified++
+				tokens.Modified += line.tokens
+			} else {
+				count.Added++
+				tokens.Added += line.tokens
+			}
+		}
+		for i := len(added); i < len(removed); i++ {
+			count.Removed++
+			tokens.Removed += removed[i].tokens
+		}
+	}
+
+	// the common prefix and suffix are the same
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && equal(prefix, prefix) {
+		same(to[prefix])
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && equal(len(from)-1-suffix, len(to)-1-suffix) {
+		same(to[len(to)-1-suffix])
+		suffix++
+	}
+	from, to = from[prefix:len(from)-suffix], to[prefix:len(to)-suffix]
+	if len(from)*len(to) > maxDiffCells {
+		changed(from, to)
+		return
+	}
+
+	// lcs[i*cols+j] is the length of the longest common subsequence of from[i:] and to[j:]
+	cols := len(to) + 1
+	lcs := make([]int32, (len(from)+1)*cols)
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if equal(i, j) {
+				lcs[i*cols+j] = lcs[(i+1)*cols+j+1] + 1
+			} else if lcs[(i+1)*cols+j] >= lcs[i*cols+j+1] {
+				lcs[i*cols+j] = lcs[(i+1)*cols+j]
+			} else {
+				lcs[i*cols+j] = lcs[i*cols+j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	removedStart, addedStart := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case equal(i, j):
+			changed(from[removedStart:i], to[addedStart:j])
+			same(to[j])
+			i++
+			j++
+			removedStart, addedStart = i, j
+		case lcs[(i+1)*cols+j] >= lcs[i*cols+j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	changed(from[removedStart:], to[addedStart:])
+}
+
+// diffCounts returns the change of a file by comparing its counts only, the smaller of its old and new counts
+// is modified and the difference is added or removed.
+func diffCounts(from, to *ClocFile) DiffStat {
+	if sameCounts(from, to) {
+		return sameStat(to)
+	}
+	return DiffStat{
+		Lang:     to.Lang,
+		Files:    DiffCount{Modified: 1},
+		Blanks:   modifiedCount(from.Blanks, to.Blanks),
+		Comments: modifiedCount(from.Comments, to.Comments),
+		Code:     modifiedCount(from.Code, to.Code),
+		Tokens:   modifiedCount(from.Tokens, to.Tokens),
+	}
+}
+
+func sameStat(file *ClocFile) DiffStat {
+	return DiffStat{
+		Lang:     file.Lang,
+		Files:    DiffCount{Same: 1},
+		Blanks:   DiffCount{Same: file.Blanks},
+		Comments: DiffCount{Same: file.Comments},
+		Code:     DiffCount{Same: file.Code},
+		Tokens:   DiffCount{Same: file.Tokens},
+	}
+}
+
+func sameCounts(from, to *ClocFile) bool {
+	if from.Lang != to.Lang || from.Code != to.Code || from.Comments != to.Comments || from.Blanks != to.Blanks ||
+		from.Tokens != to.Tokens || from.CodeTokens != to.CodeTokens || from.CommentTokens != to.CommentTokens || from.BlankTokens != to.BlankTokens ||
+		len(from.EncodingTokens) != len(to.EncodingTokens) {
+		return false
+	}
+	for name, tokens := range from.EncodingTokens {
+		if to.EncodingTokens[name] != tokens {
+			return false
+		}
+	}
+	return true
+}
+
+func modifiedCount(from, to int32) DiffCount {
+	if from > to {
+		return DiffCount{Modified: to, Removed: from - to}
+	}
+	return DiffCount{Modified: from, Added: to - from}
+}
+
+func (s *DiffStat) add(other *DiffStat) {
+	s.Files.add(other.Files)
+	s.Blanks.add(other.Blanks)
+	s.Comments.add(other.Comments)
+	s.Code.add(other.Code)
+	s.Tokens.add(other.Tokens)
+}
+
+func (c *DiffCount) add(other DiffCount) {
+	c.Same += other.Same
+	c.Modified += other.Modified
+	c.Added += other.Added
+	c.Removed += other.Removed
+}
+
+func sortedDiffStats(stats map[string]*DiffStat) DiffStats {
+	sorted := make(DiffStats, 0, len(stats))
+	for _, stat := range stats {
+		sorted = append(sorted, *stat)
+	}
+	sorted.SortByName()
+	return sorted
+}
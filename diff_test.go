@@ -0,0 +1,174 @@
+package ctoc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	from := t.TempDir()
+	to := t.TempDir()
+	writeTestFiles(t, from, map[string]string{
+		"same.go":     "package main\n",
+		"modified.go": "package main\n\n// a b\nfunc a() {}\nfunc b() {}\n",
+		"renamed.go":  "package main\n\nfunc B() {}\n",
+		"removed.py":  "# comment\nprint(1)\n",
+	})
+	writeTestFiles(t, to, map[string]string{
+		"same.go":      "package main\n",
+		"modified.go":  "package main\n\nfunc a() {}\n",
+		"renamed.go":   "package main\n\nfunc C() {}\n",
+		"sub/added.go": "package sub\n\nfunc c() {}\n",
+	})
+
+	analyze := func(root string) *Result {
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = wordTokenizer{}
+		result, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{root})
+		if err != nil {
+			t.Fatalf("Analyze() error. err=[%v]", err)
+		}
+		return result
+	}
+	diff := Diff(analyze(from), from, analyze(to), to)
+
+	expectedFiles := map[string]*DiffStat{
+		"same.go": {
+			Name: "same.go", Lang: "Go",
+			Files: DiffCount{Same: 1}, Code: DiffCount{Same: 1}, Tokens: DiffCount{Same: 2},
+		},
+		"modified.go": {
+			Name: "modified.go", Lang: "Go",
+			Files:    DiffCount{Modified: 1},
+			Blanks:   DiffCount{Same: 1},
+			Comments: DiffCount{Removed: 1},
+			Code:     DiffCount{Same: 2, Removed: 1},
+			Tokens:   DiffCount{Same: 5, Removed: 6},
+		},
+		// the counts are the same, but not the content
+		"renamed.go": {
+			Name: "renamed.go", Lang: "Go",
+			Files:  DiffCount{Modified: 1},
+			Blanks: DiffCount{Same: 1},
+			Code:   DiffCount{Same: 1, Modified: 1},
+			Tokens: DiffCount{Same: 2, Modified: 3},
+		},
+		"removed.py": {
+			Name: "removed.py", Lang: "Python",
+			Files: DiffCount{Removed: 1}, Comments: DiffCount{Removed: 1}, Code: DiffCount{Removed: 1},
+			Tokens: DiffCount{Removed: 3},
+		},
+		"sub/added.go": {
+			Name: "sub/added.go", Lang: "Go",
+			Files: DiffCount{Added: 1}, Blanks: DiffCount{Added: 1}, Code: DiffCount{Added: 2},
+			Tokens: DiffCount{Added: 5},
+		},
+	}
+	if !reflect.DeepEqual(diff.Files, expectedFiles) {
+		for name, stat := range diff.Files {
+			t.Logf("%s: %+v", name, *stat)
+		}
+		t.Errorf("invalid logic. files are not compared")
+	}
+
+	goStat := diff.Languages["Go"]
+	if goStat.Files != (DiffCount{Same: 1, Modified: 2, Added: 1}) || goStat.Code != (DiffCount{Same: 4, Modified: 1, Added: 2, Removed: 1}) {
+		t.Errorf("invalid logic. language=%+v", *goStat)
+	}
+	if diff.Total.Files != (DiffCount{Same: 1, Modified: 2, Added: 1, Removed: 1}) || diff.Total.Tokens != (DiffCount{Same: 9, Modified: 3, Added: 5, Removed: 9}) {
+		t.Errorf("invalid logic. total=%+v", *diff.Total)
+	}
+
+	stats := NewJSONDiffResult(diff, false).Languages
+	if len(stats) != 2 || stats[0].Name != "Go" || stats[1].Name != "Python" {
+		t.Errorf("invalid logic. languages=%+v", stats)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	lines := func(texts ...string) []chunkLine {
+		var lines []chunkLine
+		for _, text := range texts {
+			lines = append(lines, chunkLine{text: text, kind: lineCode, tokens: int32(len(text))})
+		}
+		return lines
+	}
+
+	var count, tokens DiffCount
+	diffLines(lines("a", "b", "c", "d", "e"), lines("a", "bb", "c", "x", "yy", "e", "f"), &count, &tokens)
+	if count != (DiffCount{Same: 3, Modified: 2, Added: 2}) || tokens != (DiffCount{Same: 3, Modified: 3, Added: 3}) {
+		t.Errorf("invalid logic. count=%+v tokens=%+v", count, tokens)
+	}
+
+	count, tokens = DiffCount{}, DiffCount{}
+	diffLines(lines("a", "b", "c"), lines("c"), &count, &tokens)
+	if count != (DiffCount{Same: 1, Removed: 2}) || tokens != (DiffCount{Same: 1, Removed: 2}) {
+		t.Errorf("invalid logic. count=%+v tokens=%+v", count, tokens)
+	}
+}
+
+func TestDiffCounts(t *testing.T) {
+	// the files of results not returned by Processor can not be read again, so only their counts are compared
+	from := &Result{Files: map[string]*ClocFile{"a.go": {Name: "a.go", Lang: "Go", Code: 2, Tokens: 5}}}
+	to := &Result{Files: map[string]*ClocFile{"a.go": {Name: "a.go", Lang: "Go", Code: 2, Tokens: 6}}}
+	diff := Diff(from, "", to, "")
+	if stat := diff.Files["a.go"]; stat.Files != (DiffCount{Modified: 1}) || stat.Tokens != (DiffCount{Modified: 5, Added: 1}) {
+		t.Errorf("invalid logic. stat=%+v", *stat)
+	}
+}
+
+func TestDiffLanguageChanged(t *testing.T) {
+	from := t.TempDir()
+	to := t.TempDir()
+	writeTestFiles(t, from, map[string]string{"tool": "#!/bin/sh\necho 1\n"})
+	writeTestFiles(t, to, map[string]string{"tool": "#!/usr/bin/env python\nprint(1)\n"})
+
+	analyze := func(root string) *Result {
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = wordTokenizer{}
+		result, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{root})
+		if err != nil {
+			t.Fatalf("Analyze() error. err=[%v]", err)
+		}
+		return result
+	}
+	diff := Diff(analyze(from), from, analyze(to), to)
+
+	if stat := diff.Files["tool"]; stat.Lang != "Python" || stat.Files != (DiffCount{Added: 1, Removed: 1}) {
+		t.Errorf("invalid logic. stat=%+v", *stat)
+	}
+	if stat := diff.Languages["Bourne Shell"]; stat == nil || stat.Files != (DiffCount{Removed: 1}) || stat.Code != (DiffCount{Removed: 2}) {
+		t.Errorf("invalid logic. language=%+v", stat)
+	}
+	if stat := diff.Languages["Python"]; stat == nil || stat.Files != (DiffCount{Added: 1}) || stat.Code != (DiffCount{Added: 2}) {
+		t.Errorf("invalid logic. language=%+v", stat)
+	}
+	if diff.Total.Files != (DiffCount{Added: 1, Removed: 1}) {
+		t.Errorf("invalid logic. total=%+v", *diff.Total)
+	}
+}
+
+func TestDiffWholeFile(t *testing.T) {
+	from := t.TempDir()
+	to := t.TempDir()
+	writeTestFiles(t, from, map[string]string{"a.go": "package main\n\nfunc a() {}\n"})
+	writeTestFiles(t, to, map[string]string{"a.go": "package main\n\nfunc a() {}\nfunc b() {}\n"})
+
+	analyze := func(root string) *Result {
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = wordTokenizer{}
+		clocOpts.WholeFile = true
+		result, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{root})
+		if err != nil {
+			t.Fatalf("Analyze() error. err=[%v]", err)
+		}
+		return result
+	}
+	fromResult, toResult := analyze(from), analyze(to)
+	diff := Diff(fromResult, from, toResult, to)
+
+	fromTokens, toTokens := fromResult.Total.Tokens, toResult.Total.Tokens
+	if stat := diff.Files["a.go"]; stat.Code != (DiffCount{Same: 2, Added: 1}) || stat.Tokens != (DiffCount{Modified: fromTokens, Added: toTokens - fromTokens}) {
+		t.Errorf("invalid logic. stat=%+v tokens=%v->%v", *stat, fromTokens, toTokens)
+	}
+}
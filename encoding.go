@@ -0,0 +1,151 @@
+package ctoc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// TiktokenEncoding defines an encoding in the tiktoken format that is not built into tiktoken-go.
+type TiktokenEncoding struct {
+	Name string
+	// PatStr is the regular expression splitting text into pieces before BPE merges.
+	PatStr string
+	// BpeFile is the URL or the file name of the .tiktoken BPE ranks.
+	BpeFile       string
+	SpecialTokens map[string]int
+	// Models are the model names using the encoding.
+	Models []string
+}
+
+// builtinEncodings are the encodings provided by tiktoken-go.
+var builtinEncodings = []string{
+	tiktoken.MODEL_O200K_BASE,
+	tiktoken.MODEL_CL100K_BASE,
+	tiktoken.MODEL_P50K_BASE,
+	tiktoken.MODEL_P50K_EDIT,
+	tiktoken.MODEL_R50K_BASE,
+}
+
+var (
+	encodingsMu         sync.RWMutex
+	registeredEncodings = make(map[string]TiktokenEncoding)
+	registeredModels    = make(map[string]string)
+)
+
+// bpeLoader is the loader used for the registered encodings, it follows tiktoken-go's loader.
+var bpeLoader tiktoken.BpeLoader = tiktoken.NewDefaultBpeLoader()
+
+func currentBpeLoader() tiktoken.BpeLoader {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+	return bpeLoader
+}
+
+func setBpeLoader(loader tiktoken.BpeLoader) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	bpeLoader = loader
+	tiktoken.SetBpeLoader(loader)
+}
+
+// RegisterEncoding makes enc available to NewTiktokenTokenizer and its models to TokenizerForModel.
+// The registration only applies to the program calling it, the ctoc command knows the built-in encodings only.
+func RegisterEncoding(enc TiktokenEncoding) error {
+	if enc.Name == "" || enc.PatStr == "" || enc.BpeFile == "" {
+		return fmt.Errorf("encoding requires name, pattern and bpe file")
+	}
+	for _, name := range builtinEncodings {
+		if name == enc.Name {
+			return fmt.Errorf("encoding %s is built in", enc.Name)
+		}
+	}
+
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	registeredEncodings[enc.Name] = enc
+	for _, model := range enc.Models {
+		registeredModels[model] = enc.Name
+	}
+	return nil
+}
+
+// Encodings returns the names of all the built-in and registered encodings.
+func Encodings() []string {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+
+	names := append([]string{}, builtinEncodings...)
+	for name := range registeredEncodings {
+		names = append(names, name)
+	}
+	sort.Strings(names[len(builtinEncodings):])
+	return names
+}
+
+// ModelEncodings returns the encoding names keyed by model name.
+func ModelEncodings() map[string]string {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+
+	models := make(map[string]string, len(tiktoken.MODEL_TO_ENCODING)+len(registeredModels))
+	for model, encoding := range tiktoken.MODEL_TO_ENCODING {
+		models[model] = encoding
+	}
+	for model, encoding := range registeredModels {
+		models[model] = encoding
+	}
+	return models
+}
+
+// getTiktoken returns the tiktoken-go encoder for a built-in or registered encoding.
+func getTiktoken(encoding string) (*tiktoken.Tiktoken, error) {
+	encodingsMu.RLock()
+	enc, ok := registeredEncodings[encoding]
+	loader := bpeLoader
+	encodingsMu.RUnlock()
+	if !ok {
+		return tiktoken.GetEncoding(encoding)
+	}
+
+	ranks, err := loader.LoadTiktokenBpe(enc.BpeFile)
+	if err != nil {
+		return nil, err
+	}
+	bpe, err := tiktoken.NewCoreBPE(ranks, enc.SpecialTokens, enc.PatStr)
+	if err != nil {
+		return nil, err
+	}
+	specialTokensSet := make(map[string]any, len(enc.SpecialTokens))
+	for k := range enc.SpecialTokens {
+		specialTokensSet[k] = true
+	}
+	return tiktoken.NewTiktoken(bpe, &tiktoken.Encoding{
+		Name:           enc.Name,
+		PatStr:         enc.PatStr,
+		MergeableRanks: ranks,
+		SpecialTokens:  enc.SpecialTokens,
+	}, specialTokensSet), nil
+}
+
+// EncodingForModel returns the encoding name used by the model, model names are
+// matched exactly first and then by the known prefixes such as "gpt-4o-".
+func EncodingForModel(model string) (string, error) {
+	if encoding, ok := ModelEncodings()[model]; ok {
+		return encoding, nil
+	}
+
+	var prefix string
+	for p := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		return "", fmt.Errorf("unknown model: %s", model)
+	}
+	return tiktoken.MODEL_PREFIX_TO_ENCODING[prefix], nil
+}
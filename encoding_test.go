@@ -0,0 +1,103 @@
+package ctoc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewTiktokenTokenizerO200k(t *testing.T) {
+	tke, err := NewTiktokenTokenizer("o200k_base")
+	if err != nil {
+		t.Fatalf("NewTiktokenTokenizer() error. err=[%v]", err)
+	}
+	if n := tke.Count("hello world"); n != 2 {
+		t.Errorf("invalid logic. tokens=%v", n)
+	}
+	if ModelEncodings()["gpt-4o"] != "o200k_base" {
+		t.Errorf("invalid logic. gpt-4o encoding=%v", ModelEncodings()["gpt-4o"])
+	}
+}
+
+func TestRegisterEncoding(t *testing.T) {
+	dir := t.TempDir()
+	// "a", "b", " ", "ab"
+	if err := os.WriteFile(filepath.Join(dir, "ab_base.tiktoken"), []byte("YQ== 0\nYg== 1\nIA== 2\nYWI= 3\n"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error. err=[%v]", err)
+	}
+	encodingsMu.Lock()
+	orig := bpeLoader
+	bpeLoader = NewLocalBpeLoader(dir)
+	encodingsMu.Unlock()
+	t.Cleanup(func() {
+		encodingsMu.Lock()
+		defer encodingsMu.Unlock()
+		bpeLoader = orig
+		delete(registeredEncodings, "ab_base")
+		delete(registeredModels, "ab-model")
+	})
+
+	err := RegisterEncoding(TiktokenEncoding{
+		Name:          "ab_base",
+		PatStr:        `[ab]+|\s+`,
+		BpeFile:       "https://example.com/ab_base.tiktoken",
+		SpecialTokens: map[string]int{"<|endoftext|>": 4},
+		Models:        []string{"ab-model"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterEncoding() error. err=[%v]", err)
+	}
+
+	tke, err := NewTiktokenTokenizer("ab_base")
+	if err != nil {
+		t.Fatalf("NewTiktokenTokenizer() error. err=[%v]", err)
+	}
+	if tokens := tke.Encode("ab ab"); len(tokens) != 3 || tokens[0] != 3 || tokens[1] != 2 {
+		t.Errorf("invalid logic. tokens=%v", tokens)
+	}
+	if ModelEncodings()["ab-model"] != "ab_base" {
+		t.Errorf("invalid logic. model encoding=%v", ModelEncodings()["ab-model"])
+	}
+
+	var found bool
+	for _, name := range Encodings() {
+		if name == "ab_base" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("invalid logic. encodings=%v", Encodings())
+	}
+}
+
+func TestRegisterEncodingInvalid(t *testing.T) {
+	if err := RegisterEncoding(TiktokenEncoding{Name: "cl100k_base", PatStr: ".", BpeFile: "cl100k_base.tiktoken"}); err == nil {
+		t.Errorf("invalid logic. built-in encoding should not be registered")
+	}
+	if err := RegisterEncoding(TiktokenEncoding{Name: "empty_base"}); err == nil {
+		t.Errorf("invalid logic. encoding without pattern should fail")
+	}
+}
+
+func TestEncodingForModel(t *testing.T) {
+	tests := map[string]string{
+		"gpt-4":             "cl100k_base",
+		"gpt-4o":            "o200k_base",
+		"gpt-4o-2024-05-13": "o200k_base",
+		"gpt-4-32k":         "cl100k_base",
+		"text-davinci-003":  "p50k_base",
+	}
+	for model, expected := range tests {
+		encoding, err := EncodingForModel(model)
+		if err != nil {
+			t.Errorf("EncodingForModel() error. model=%v err=[%v]", model, err)
+		}
+		if encoding != expected {
+			t.Errorf("invalid encoding. model=%v encoding=%v", model, encoding)
+		}
+	}
+
+	if _, err := EncodingForModel("unknown-model"); err == nil {
+		t.Errorf("invalid logic. unknown model should fail")
+	}
+}
@@ -0,0 +1,113 @@
+package ctoc
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// EstimatorName is the name of the Estimator tokenizer.
+const EstimatorName string = "estimate"
+
+// Default ratio and error rate of the languages without calibration.
+const (
+	defaultBytesPerToken   = 3.5
+	defaultTokensErrorRate = 0.35
+)
+
+// languageEstimates is the approximate bytes per token ratio of cl100k_base and the expected relative error of each language.
+var languageEstimates = map[string][2]float64{
+	"Assembly":     {2.50, 0.25},
+	"BASH":         {3.35, 0.20},
+	"Bourne Shell": {3.30, 0.15},
+	"C":            {3.45, 0.20},
+	"C Header":     {3.60, 0.35},
+	"CSS":          {3.20, 0.45},
+	"Go":           {3.55, 0.25},
+	"HTML":         {3.20, 0.15},
+	"JSON":         {2.80, 0.25},
+	"JavaScript":   {3.85, 0.20},
+	"Makefile":     {3.35, 0.15},
+	"Markdown":     {4.15, 0.20},
+	"Perl":         {3.30, 0.25},
+	"Plain Text":   {3.35, 0.25},
+	"Python":       {3.95, 0.30},
+	"TypeScript":   {4.00, 0.20},
+	"XML":          {3.00, 0.10},
+	"YAML":         {2.65, 0.35},
+}
+
+// Estimator is a Tokenizer estimating the token counts from the text length instead of encoding it,
+// which is much faster on huge trees. Each line is estimated as one token for the indentation
+// and the length of the rest divided by BytesPerToken.
+// Estimator does not produce token ids, Encode always returns nil.
+type Estimator struct {
+	// BytesPerToken is the average number of bytes per token.
+	BytesPerToken float64
+	// ErrorRate is the expected relative error of the estimated token counts.
+	ErrorRate float64
+
+	perLanguage bool
+}
+
+// NewEstimator returns Estimator with the default ratio, analyzed files use the ratio of their language.
+// An Estimator created as a struct literal uses its own ratio for all languages.
+func NewEstimator() *Estimator {
+	return &Estimator{
+		BytesPerToken: defaultBytesPerToken,
+		ErrorRate:     defaultTokensErrorRate,
+		perLanguage:   true,
+	}
+}
+
+// ForLanguage returns Estimator with the ratio and the error rate of the language,
+// or e itself if it was not created by NewEstimator or the language has no ratio.
+func (e *Estimator) ForLanguage(language *Language) *Estimator {
+	if !e.perLanguage || language.BytesPerToken <= 0 {
+		return e
+	}
+	return &Estimator{
+		BytesPerToken: language.BytesPerToken,
+		ErrorRate:     language.TokensErrorRate,
+	}
+}
+
+// Encode returns nil, Estimator does not produce token ids.
+func (e *Estimator) Encode(text string) []int {
+	return nil
+}
+
+// Count returns the estimated number of tokens for text.
+func (e *Estimator) Count(text string) int {
+	tokens := 0
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if len(trimmed) < len(line) {
+			tokens++
+		}
+		trimmed = strings.TrimRight(trimmed, "\r")
+		if trimmed == "" {
+			continue
+		}
+		if n := int(math.Round(float64(len(trimmed)) / e.BytesPerToken)); n > 1 {
+			tokens += n
+		} else {
+			tokens++
+		}
+	}
+	return tokens
+}
+
+// Name returns the tokenizer name.
+func (e *Estimator) Name() string {
+	return EstimatorName
+}
+
+func (e *Estimator) definitionDigest() string {
+	return fmt.Sprintf("%v:%v:%v", e.BytesPerToken, e.ErrorRate, e.perLanguage)
+}
+
+// ErrorBound returns the error bound of the estimated token count.
+func (e *Estimator) ErrorBound(tokens int32) int32 {
+	return int32(math.Ceil(float64(tokens) * e.ErrorRate))
+}
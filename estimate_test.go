@@ -0,0 +1,92 @@
+package ctoc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEstimatorCount(t *testing.T) {
+	estimator := &Estimator{BytesPerToken: 4, ErrorRate: 0.1}
+
+	tests := []struct {
+		text   string
+		tokens int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"\treturn nil", 4},
+		{"a\n  bb\r\n", 3},
+	}
+	for _, test := range tests {
+		if n := estimator.Count(test.text); n != test.tokens {
+			t.Errorf("invalid logic. text=%q tokens=%v", test.text, n)
+		}
+	}
+	if ids := estimator.Encode("a"); ids != nil {
+		t.Errorf("invalid logic. ids=%v", ids)
+	}
+	if bound := estimator.ErrorBound(15); bound != 2 {
+		t.Errorf("invalid logic. bound=%v", bound)
+	}
+}
+
+func TestEstimatorForLanguage(t *testing.T) {
+	languages := NewDefinedLanguages()
+	estimator := NewEstimator().ForLanguage(languages.Langs["Go"])
+	if estimator.BytesPerToken != languageEstimates["Go"][0] || estimator.ErrorRate != languageEstimates["Go"][1] {
+		t.Errorf("invalid logic. estimator=%+v", estimator)
+	}
+
+	estimator = NewEstimator().ForLanguage(languages.Langs["Zig"])
+	if estimator.BytesPerToken != defaultBytesPerToken || estimator.ErrorRate != defaultTokensErrorRate {
+		t.Errorf("invalid logic. estimator=%+v", estimator)
+	}
+
+	// the ratio of the caller is used for all languages
+	custom := &Estimator{BytesPerToken: 4, ErrorRate: 0.1}
+	if estimator := custom.ForLanguage(languages.Langs["Go"]); estimator != custom {
+		t.Errorf("invalid logic. estimator=%+v", estimator)
+	}
+}
+
+func TestAnalyzeReaderWithEstimator(t *testing.T) {
+	buf := bytes.NewBuffer([]byte(`package main
+
+// hello world
+func main() {}
+	
+`))
+
+	language := NewLanguage("Go", []string{"//"}, [][]string{{"/*", "*/"}})
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = NewEstimator()
+	clocFile := AnalyzeReader("test.go", language, buf, clocOpts)
+
+	if clocFile.Tokens != 12 {
+		t.Errorf("invalid logic. tokens=%v", clocFile.Tokens)
+	}
+	if clocFile.CodeTokens != 7 || clocFile.CommentTokens != 4 || clocFile.BlankTokens != 1 {
+		t.Errorf("invalid logic. code_tokens=%v comment_tokens=%v blank_tokens=%v",
+			clocFile.CodeTokens, clocFile.CommentTokens, clocFile.BlankTokens)
+	}
+	if clocFile.TokensError != 3 {
+		t.Errorf("invalid logic. tokens_error=%v", clocFile.TokensError)
+	}
+}
+
+func TestAnalyzeReaderWithCustomEstimator(t *testing.T) {
+	buf := bytes.NewBuffer([]byte("package main\n\nfunc main() {}\n"))
+
+	language := NewLanguage("Go", []string{"//"}, [][]string{{"/*", "*/"}})
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = &Estimator{BytesPerToken: 2, ErrorRate: 0.5}
+	clocFile := AnalyzeReader("test.go", language, buf, clocOpts)
+
+	// "package main" is 6 tokens and "func main() {}" is 7 tokens with 2 bytes per token
+	if clocFile.Tokens != 13 {
+		t.Errorf("invalid logic. tokens=%v", clocFile.Tokens)
+	}
+	if clocFile.TokensError != 7 {
+		t.Errorf("invalid logic. tokens_error=%v", clocFile.TokensError)
+	}
+}
@@ -2,9 +2,9 @@ package ctoc
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
-	"os"
 	"sort"
 	"strings"
 	"unicode"
@@ -18,6 +18,14 @@ type ClocFile struct {
 	Name     string `xml:"name,attr" json:"name"`
 	Lang     string `xml:"language,attr" json:"language"`
 	Tokens   int32  `xml:"tokens,attr" json:"tokens"`
+
+	CodeTokens    int32 `xml:"code_tokens,attr" json:"code_tokens"`
+	CommentTokens int32 `xml:"comment_tokens,attr" json:"comment_tokens"`
+	BlankTokens   int32 `xml:"blank_tokens,attr" json:"blank_tokens"`
+	TokensError   int32 `xml:"tokens_error,attr,omitempty" json:"tokens_error,omitempty"`
+
+	EncodingTokens TokensByEncoding `xml:"-" json:"encoding_tokens,omitempty"`
+	Costs          CostByModel      `xml:"-" json:"costs,omitempty"`
 }
 
 // ClocFiles is gocloc result set.
@@ -66,7 +74,11 @@ func (cf ClocFiles) SortByTokens() {
 
 // AnalyzeFile is analyzing file, this function calls AnalyzeReader() inside.
 func AnalyzeFile(filename string, language *Language, opts *ClocOptions) *ClocFile {
-	fp, err := os.Open(filename)
+	if opts.Cache != nil && opts.OnCode == nil && opts.OnComment == nil && opts.OnBlank == nil && !opts.Debug {
+		return analyzeFileWithCache(filename, language, opts)
+	}
+
+	fp, err := opts.openFile(filename)
 	if err != nil {
 		// ignore error
 		return &ClocFile{Name: filename}
@@ -76,6 +88,34 @@ func AnalyzeFile(filename string, language *Language, opts *ClocOptions) *ClocFi
 	return AnalyzeReader(filename, language, fp, opts)
 }
 
+// analyzeFileWithCache returns the cached ClocFile of the file content if any,
+// or analyzes the file and caches the result.
+func analyzeFileWithCache(filename string, language *Language, opts *ClocOptions) *ClocFile {
+	content, err := opts.readFile(filename)
+	if err != nil {
+		// ignore error
+		return &ClocFile{Name: filename}
+	}
+
+	key := cacheKey(content, language, opts)
+	if cached, ok := opts.Cache.get(key); ok {
+		clocFile := *cached
+		clocFile.Name = filename
+		clocFile.Lang = language.Name
+		return &clocFile
+	}
+
+	clocFile := AnalyzeReader(filename, language, bytes.NewReader(content), opts)
+	if opts.context().Err() != nil {
+		// the file may be analyzed partially
+		return clocFile
+	}
+	cached := *clocFile
+	cached.Name = ""
+	opts.Cache.put(key, &cached)
+	return clocFile
+}
+
 // AnalyzeReader is analyzing file for io.Reader.
 func AnalyzeReader(filename string, language *Language, file io.Reader, opts *ClocOptions) *ClocFile {
 	if opts.Debug {
@@ -87,6 +127,24 @@ func AnalyzeReader(filename string, language *Language, file io.Reader, opts *Cl
 		Lang: language.Name,
 	}
 
+	tokenizer := opts.Tokenizer
+	estimator, isEstimator := tokenizer.(*Estimator)
+	if isEstimator {
+		estimator = estimator.ForLanguage(language)
+		tokenizer = estimator
+	}
+
+	if tokenizer != nil && len(opts.Tokenizers) > 0 {
+		clocFile.EncodingTokens = make(TokensByEncoding, len(opts.Tokenizers)+1)
+	}
+
+	var content *bytes.Buffer
+	if tokenizer != nil && opts.WholeFile {
+		content = getByteSlice()
+		defer putByteSlice(content)
+		file = io.TeeReader(file, content)
+	}
+
 	isFirstLine := true
 	var inComments [][2]string
 	buf := getByteSlice()
@@ -94,21 +152,39 @@ func AnalyzeReader(filename string, language *Language, file io.Reader, opts *Cl
 	scanner := bufio.NewScanner(file)
 	scanner.Buffer(buf.Bytes(), 1024*1024)
 
+	done := opts.context().Done()
+
 scannerloop:
 	for scanner.Scan() {
+		select {
+		case <-done:
+			break scannerloop
+		default:
+		}
+
 		lineOrg := scanner.Text()
-		tokens := opts.Tokenizer.Encode(lineOrg, nil, nil)
-		clocFile.Tokens += int32(len(tokens))
+		var lineTokens int32
+		if tokenizer != nil {
+			lineTokens = int32(tokenizer.Count(lineOrg))
+		}
+		if !opts.WholeFile {
+			clocFile.Tokens += lineTokens
+			if clocFile.EncodingTokens != nil {
+				for _, extra := range opts.Tokenizers {
+					clocFile.EncodingTokens[extra.Name()] += int32(extra.Count(lineOrg))
+				}
+			}
+		}
 		line := strings.TrimSpace(lineOrg)
 
 		if len(strings.TrimSpace(line)) == 0 {
-			onBlank(clocFile, opts, len(inComments) > 0, line, lineOrg)
+			onBlank(clocFile, opts, len(inComments) > 0, line, lineOrg, lineTokens)
 			continue
 		}
 
 		// shebang line is 'code'
 		if isFirstLine && strings.HasPrefix(line, "#!") {
-			onCode(clocFile, opts, len(inComments) > 0, line, lineOrg)
+			onCode(clocFile, opts, len(inComments) > 0, line, lineOrg, lineTokens)
 			isFirstLine = false
 			continue
 		}
@@ -127,25 +203,25 @@ scannerloop:
 							break singleloop
 						}
 					}
-					onComment(clocFile, opts, len(inComments) > 0, line, lineOrg)
+					onComment(clocFile, opts, len(inComments) > 0, line, lineOrg, lineTokens)
 					continue scannerloop
 				}
 			}
 
 			if len(language.multiLines) == 0 {
-				onCode(clocFile, opts, len(inComments) > 0, line, lineOrg)
+				onCode(clocFile, opts, len(inComments) > 0, line, lineOrg, lineTokens)
 				continue scannerloop
 			}
 		}
 
 		if len(inComments) == 0 && !containsComment(line, language.multiLines) {
-			onCode(clocFile, opts, len(inComments) > 0, line, lineOrg)
+			onCode(clocFile, opts, len(inComments) > 0, line, lineOrg, lineTokens)
 			continue scannerloop
 		}
 
 		lenLine := len(line)
 		if len(language.multiLines) == 1 && len(language.multiLines[0]) == 2 && language.multiLines[0][0] == "" {
-			onCode(clocFile, opts, len(inComments) > 0, line, lineOrg)
+			onCode(clocFile, opts, len(inComments) > 0, line, lineOrg, lineTokens)
 			continue
 		}
 		codeFlags := make([]bool, len(language.multiLines))
@@ -181,20 +257,39 @@ scannerloop:
 		}
 
 		if isCode {
-			onCode(clocFile, opts, len(inComments) > 0, line, lineOrg)
+			onCode(clocFile, opts, len(inComments) > 0, line, lineOrg, lineTokens)
 		} else {
-			onComment(clocFile, opts, len(inComments) > 0, line, lineOrg)
+			onComment(clocFile, opts, len(inComments) > 0, line, lineOrg, lineTokens)
 		}
 	}
 
+	if content != nil {
+		clocFile.Tokens = int32(tokenizer.Count(content.String()))
+		if clocFile.EncodingTokens != nil {
+			for _, extra := range opts.Tokenizers {
+				clocFile.EncodingTokens[extra.Name()] = int32(extra.Count(content.String()))
+			}
+		}
+	}
+	if clocFile.EncodingTokens != nil {
+		clocFile.EncodingTokens[tokenizer.Name()] = clocFile.Tokens
+	}
+	if isEstimator {
+		clocFile.TokensError = estimator.ErrorBound(clocFile.Tokens)
+	}
+
 	return clocFile
 }
 
-func onBlank(clocFile *ClocFile, opts *ClocOptions, isInComments bool, line, lineOrg string) {
+func onBlank(clocFile *ClocFile, opts *ClocOptions, isInComments bool, line, lineOrg string, tokens int32) {
 	clocFile.Blanks++
+	clocFile.BlankTokens += tokens
 	if opts.OnBlank != nil {
 		opts.OnBlank(line)
 	}
+	if opts.onLine != nil {
+		opts.onLine(lineOrg, lineBlank, tokens)
+	}
 
 	if opts.Debug {
 		fmt.Printf("[BLNK, cd:%d, cm:%d, bk:%d, iscm:%v] %s\n",
@@ -202,11 +297,15 @@ func onBlank(clocFile *ClocFile, opts *ClocOptions, isInComments bool, line, lin
 	}
 }
 
-func onComment(clocFile *ClocFile, opts *ClocOptions, isInComments bool, line, lineOrg string) {
+func onComment(clocFile *ClocFile, opts *ClocOptions, isInComments bool, line, lineOrg string, tokens int32) {
 	clocFile.Comments++
+	clocFile.CommentTokens += tokens
 	if opts.OnComment != nil {
 		opts.OnComment(line)
 	}
+	if opts.onLine != nil {
+		opts.onLine(lineOrg, lineComment, tokens)
+	}
 
 	if opts.Debug {
 		fmt.Printf("[COMM, cd:%d, cm:%d, bk:%d, iscm:%v] %s\n",
@@ -214,11 +313,15 @@ func onComment(clocFile *ClocFile, opts *ClocOptions, isInComments bool, line, l
 	}
 }
 
-func onCode(clocFile *ClocFile, opts *ClocOptions, isInComments bool, line, lineOrg string) {
+func onCode(clocFile *ClocFile, opts *ClocOptions, isInComments bool, line, lineOrg string, tokens int32) {
 	clocFile.Code++
+	clocFile.CodeTokens += tokens
 	if opts.OnCode != nil {
 		opts.OnCode(line)
 	}
+	if opts.onLine != nil {
+		opts.onLine(lineOrg, lineCode, tokens)
+	}
 
 	if opts.Debug {
 		fmt.Printf("[CODE, cd:%d, cm:%d, bk:%d, iscm:%v] %s\n",
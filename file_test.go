@@ -564,3 +564,58 @@ const color = "blue"
 		t.Errorf("invalid logic. tokens=%v", clocFile.Tokens)
 	}
 }
+
+func TestAnalyzeReaderWholeFile(t *testing.T) {
+	src := `package main
+
+import "fmt"
+
+// main prints a greeting.
+func main() {
+	fmt.Println("hello")
+}
+`
+	language := NewLanguage("Go", []string{"//"}, [][]string{{"/*", "*/"}})
+	clocOpts := NewClocOptions()
+	lineFile := AnalyzeReader("test.go", language, bytes.NewBufferString(src), clocOpts)
+
+	clocOpts.WholeFile = true
+	wholeFile := AnalyzeReader("test.go", language, bytes.NewBufferString(src), clocOpts)
+
+	if wholeFile.Code != lineFile.Code || wholeFile.Comments != lineFile.Comments || wholeFile.Blanks != lineFile.Blanks {
+		t.Errorf("invalid logic. line=%+v whole=%+v", lineFile, wholeFile)
+	}
+	if expected := int32(clocOpts.Tokenizer.Count(src)); wholeFile.Tokens != expected {
+		t.Errorf("invalid logic. tokens=%v expected=%v", wholeFile.Tokens, expected)
+	}
+	if wholeFile.Tokens <= lineFile.Tokens {
+		t.Errorf("invalid logic. whole file tokens should include newlines. line=%v whole=%v", lineFile.Tokens, wholeFile.Tokens)
+	}
+}
+
+func TestAnalyzeReaderTokensByCategory(t *testing.T) {
+	buf := bytes.NewBuffer([]byte(`package main
+
+// hello world
+func main() {}
+	
+`))
+
+	language := NewLanguage("Go", []string{"//"}, [][]string{{"/*", "*/"}})
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = wordTokenizer{}
+	clocFile := AnalyzeReader("test.go", language, buf, clocOpts)
+
+	if clocFile.CodeTokens != 5 {
+		t.Errorf("invalid logic. code_tokens=%v", clocFile.CodeTokens)
+	}
+	if clocFile.CommentTokens != 3 {
+		t.Errorf("invalid logic. comment_tokens=%v", clocFile.CommentTokens)
+	}
+	if clocFile.BlankTokens != 0 {
+		t.Errorf("invalid logic. blank_tokens=%v", clocFile.BlankTokens)
+	}
+	if clocFile.Tokens != clocFile.CodeTokens+clocFile.CommentTokens+clocFile.BlankTokens {
+		t.Errorf("invalid logic. tokens=%v", clocFile.Tokens)
+	}
+}
@@ -0,0 +1,885 @@
+package ctoc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Git object types.
+const (
+	gitObjectCommit   = 1
+	gitObjectTree     = 2
+	gitObjectBlob     = 3
+	gitObjectTag      = 4
+	gitObjectOfsDelta = 6
+	gitObjectRefDelta = 7
+)
+
+// Git file modes of index and tree entries.
+const (
+	gitModeTypeMask = 0o170000
+	gitModeDir      = 0o040000
+	gitModeSymlink  = 0o120000
+	gitModeGitlink  = 0o160000
+)
+
+// gitPackCacheSize is the number of delta bases kept in memory for each pack.
+const gitPackCacheSize = 256
+
+type gitHash [20]byte
+
+func (h gitHash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// gitFile is a file of the git index or of a tree.
+type gitFile struct {
+	path string
+	mode uint32
+	hash gitHash
+	size int64
+}
+
+// gitRepository reads the index and the objects of a git repository without the git command.
+type gitRepository struct {
+	gitDir    string
+	commonDir string
+	workTree  string
+	packs     []*gitPack
+}
+
+func openGitRepository(path string) (*gitRepository, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	r := &gitRepository{}
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			r.workTree = dir
+			r.gitDir = dotGit
+			if !info.IsDir() {
+				// .git file of worktrees and submodules
+				content, err := os.ReadFile(dotGit)
+				if err != nil {
+					return nil, err
+				}
+				gitDir := strings.TrimSpace(strings.TrimPrefix(string(content), "gitdir:"))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+				r.gitDir = gitDir
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, fmt.Errorf("not a git repository: %s", path)
+		}
+		dir = parent
+	}
+
+	r.commonDir = r.gitDir
+	if content, err := os.ReadFile(filepath.Join(r.gitDir, "commondir")); err == nil {
+		commonDir := strings.TrimSpace(string(content))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(r.gitDir, commonDir)
+		}
+		r.commonDir = commonDir
+	}
+
+	idxFiles, err := filepath.Glob(filepath.Join(r.commonDir, "objects", "pack", "*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	for _, idxFile := range idxFiles {
+		pack, err := openGitPack(idxFile)
+		if err != nil {
+			return nil, err
+		}
+		r.packs = append(r.packs, pack)
+	}
+	return r, nil
+}
+
+// indexFiles returns the files of the git index.
+func (r *gitRepository) indexFiles() ([]gitFile, error) {
+	data, err := os.ReadFile(filepath.Join(r.gitDir, "index"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, errors.New("invalid git index")
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported git index version: %d", version)
+	}
+	count := binary.BigEndian.Uint32(data[8:12])
+
+	var files []gitFile
+	var prev string
+	pos := 12
+	for i := uint32(0); i < count; i++ {
+		start := pos
+		if pos+62 > len(data) {
+			return nil, errors.New("invalid git index entry")
+		}
+		file := gitFile{
+			mode: binary.BigEndian.Uint32(data[pos+24 : pos+28]),
+			size: int64(binary.BigEndian.Uint32(data[pos+36 : pos+40])),
+		}
+		copy(file.hash[:], data[pos+40:pos+60])
+		flags := binary.BigEndian.Uint16(data[pos+60 : pos+62])
+		pos += 62
+		if version >= 3 && flags&0x4000 != 0 {
+			// extended flags
+			pos += 2
+		}
+
+		if version == 4 {
+			// the path is prefix compressed against the previous entry
+			strip, n := gitOffsetVarint(data[pos:])
+			if n <= 0 || int(strip) > len(prev) {
+				return nil, errors.New("invalid git index entry")
+			}
+			pos += n
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, errors.New("invalid git index entry")
+			}
+			file.path = prev[:len(prev)-int(strip)] + string(data[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, errors.New("invalid git index entry")
+			}
+			file.path = string(data[pos : pos+end])
+			// entries are padded with NULs to a multiple of 8 bytes
+			pos = start + (pos+end+1-start+7)&^7
+		}
+		prev = file.path
+
+		// conflicted paths have an entry for each stage
+		if len(files) > 0 && files[len(files)-1].path == file.path {
+			continue
+		}
+		if mode := file.mode & gitModeTypeMask; mode == gitModeGitlink || mode == gitModeSymlink {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// revisionFiles returns the files of the tree of revision.
+func (r *gitRepository) revisionFiles(revision string) ([]gitFile, error) {
+	tree, err := r.resolveTree(revision)
+	if err != nil {
+		return nil, err
+	}
+	var files []gitFile
+	err = r.walkTree(tree, "", func(file gitFile) {
+		files = append(files, file)
+	})
+	return files, err
+}
+
+func (r *gitRepository) walkTree(tree gitHash, prefix string, fn func(file gitFile)) error {
+	objType, data, err := r.readObject(tree)
+	if err != nil {
+		return err
+	}
+	if objType != gitObjectTree {
+		return fmt.Errorf("%s is not a tree", tree)
+	}
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || nul+21 > len(data) {
+			return fmt.Errorf("invalid tree %s", tree)
+		}
+		mode, err := strconv.ParseUint(string(data[:sp]), 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid tree %s", tree)
+		}
+		file := gitFile{
+			path: prefix + string(data[sp+1:nul]),
+			mode: uint32(mode),
+		}
+		copy(file.hash[:], data[nul+1:nul+21])
+		data = data[nul+21:]
+
+		switch file.mode & gitModeTypeMask {
+		case gitModeDir:
+			if err := r.walkTree(file.hash, file.path+"/", fn); err != nil {
+				return err
+			}
+		case gitModeGitlink, gitModeSymlink:
+		default:
+			fn(file)
+		}
+	}
+	return nil
+}
+
+// resolveTree returns the tree of a revision, e.g. HEAD~10, v1.0, a commit hash or <rev>:<path>.
+func (r *gitRepository) resolveTree(revision string) (gitHash, error) {
+	rev, path, hasPath := strings.Cut(revision, ":")
+	if rev == "" {
+		rev = "HEAD"
+	}
+	hash, err := r.resolveRevision(rev)
+	if err != nil {
+		return hash, err
+	}
+
+	// peel tags and commits to the tree
+	for {
+		objType, data, err := r.readObject(hash)
+		if err != nil {
+			return hash, err
+		}
+		switch objType {
+		case gitObjectTag:
+			hash, err = gitHeaderHash(data, "object")
+		case gitObjectCommit:
+			hash, err = gitHeaderHash(data, "tree")
+		case gitObjectTree:
+			if !hasPath || strings.Trim(path, "/") == "" {
+				return hash, nil
+			}
+			return r.treeEntry(hash, strings.Trim(path, "/"))
+		default:
+			return hash, fmt.Errorf("%s is not a tree-ish", revision)
+		}
+		if err != nil {
+			return hash, err
+		}
+	}
+}
+
+// treeEntry returns the hash of the path in tree.
+func (r *gitRepository) treeEntry(tree gitHash, path string) (gitHash, error) {
+	name, rest, _ := strings.Cut(path, "/")
+	objType, data, err := r.readObject(tree)
+	if err != nil {
+		return tree, err
+	}
+	if objType != gitObjectTree {
+		return tree, fmt.Errorf("%s is not a tree", tree)
+	}
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || nul+21 > len(data) {
+			return tree, fmt.Errorf("invalid tree %s", tree)
+		}
+		if string(data[sp+1:nul]) == name {
+			var hash gitHash
+			copy(hash[:], data[nul+1:nul+21])
+			if rest == "" {
+				return hash, nil
+			}
+			return r.treeEntry(hash, rest)
+		}
+		data = data[nul+21:]
+	}
+	return tree, fmt.Errorf("path not found in tree: %s", path)
+}
+
+// resolveRevision returns the object of a revision, supporting the ~<n> and ^<n> suffixes.
+// The ^{<type>} peeling and the @{<n>} reflog syntaxes are not supported.
+func (r *gitRepository) resolveRevision(revision string) (gitHash, error) {
+	if strings.Contains(revision, "^{") || strings.Contains(revision, "@{") {
+		return gitHash{}, fmt.Errorf("unsupported revision syntax: %s", revision)
+	}
+	i := strings.IndexAny(revision, "~^")
+	if i < 0 {
+		return r.resolveName(revision)
+	}
+	hash, err := r.resolveName(revision[:i])
+	if err != nil {
+		return hash, err
+	}
+
+	for rest := revision[i:]; rest != ""; {
+		op := rest[0]
+		rest = rest[1:]
+		digits := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+		n := 1
+		if digits > 0 {
+			if n, err = strconv.Atoi(rest[:digits]); err != nil {
+				return hash, err
+			}
+			rest = rest[digits:]
+		}
+
+		if op == '~' {
+			for ; n > 0; n-- {
+				if hash, err = r.parent(hash, 1); err != nil {
+					return hash, err
+				}
+			}
+		} else if n > 0 {
+			if hash, err = r.parent(hash, n); err != nil {
+				return hash, err
+			}
+		}
+	}
+	return hash, nil
+}
+
+// parent returns the nth parent of a commit.
+func (r *gitRepository) parent(hash gitHash, n int) (gitHash, error) {
+	objType, data, err := r.readObject(hash)
+	for err == nil && objType == gitObjectTag {
+		if hash, err = gitHeaderHash(data, "object"); err == nil {
+			objType, data, err = r.readObject(hash)
+		}
+	}
+	if err != nil {
+		return hash, err
+	}
+	if objType != gitObjectCommit {
+		return hash, fmt.Errorf("%s is not a commit", hash)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "parent ") {
+			if n--; n == 0 {
+				return parseGitHash(strings.TrimPrefix(line, "parent "))
+			}
+		}
+	}
+	return hash, fmt.Errorf("commit %s has no such parent", hash)
+}
+
+// resolveName returns the object of a ref name or a (short) object hash.
+func (r *gitRepository) resolveName(name string) (gitHash, error) {
+	if len(name) == 40 {
+		if hash, err := parseGitHash(name); err == nil {
+			return hash, nil
+		}
+	}
+	for _, ref := range []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name,
+		"refs/remotes/" + name, "refs/remotes/" + name + "/HEAD"} {
+		if hash, ok := r.readRef(ref, 0); ok {
+			return hash, nil
+		}
+	}
+	if len(name) >= 4 {
+		if _, err := hex.DecodeString(name[:len(name)&^1]); err == nil {
+			return r.resolveShortHash(strings.ToLower(name))
+		}
+	}
+	return gitHash{}, fmt.Errorf("unknown revision: %s", name)
+}
+
+func (r *gitRepository) readRef(ref string, depth int) (gitHash, bool) {
+	if depth > 10 {
+		return gitHash{}, false
+	}
+	for _, dir := range []string{r.gitDir, r.commonDir} {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref)))
+		if err != nil {
+			continue
+		}
+		line := strings.TrimSpace(strings.SplitN(string(content), "\n", 2)[0])
+		if strings.HasPrefix(line, "ref:") {
+			return r.readRef(strings.TrimSpace(strings.TrimPrefix(line, "ref:")), depth+1)
+		}
+		if hash, err := parseGitHash(strings.Fields(line + " ")[0]); err == nil {
+			return hash, true
+		}
+	}
+
+	fp, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if err != nil {
+		return gitHash{}, false
+	}
+	defer fp.Close()
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		hash, name, ok := strings.Cut(scanner.Text(), " ")
+		if ok && name == ref {
+			if hash, err := parseGitHash(hash); err == nil {
+				return hash, true
+			}
+		}
+	}
+	return gitHash{}, false
+}
+
+func (r *gitRepository) resolveShortHash(prefix string) (gitHash, error) {
+	matches := make(map[gitHash]struct{})
+	entries, _ := os.ReadDir(filepath.Join(r.commonDir, "objects", prefix[:2]))
+	for _, entry := range entries {
+		if strings.HasPrefix(prefix[:2]+entry.Name(), prefix) {
+			if hash, err := parseGitHash(prefix[:2] + entry.Name()); err == nil {
+				matches[hash] = struct{}{}
+			}
+		}
+	}
+	for _, pack := range r.packs {
+		for _, hash := range pack.findPrefix(prefix) {
+			matches[hash] = struct{}{}
+		}
+	}
+
+	if len(matches) > 1 {
+		return gitHash{}, fmt.Errorf("ambiguous revision: %s", prefix)
+	}
+	for hash := range matches {
+		return hash, nil
+	}
+	return gitHash{}, fmt.Errorf("unknown revision: %s", prefix)
+}
+
+// readObject returns the type and the content of an object.
+func (r *gitRepository) readObject(hash gitHash) (int, []byte, error) {
+	hexHash := hash.String()
+	fp, err := os.Open(filepath.Join(r.commonDir, "objects", hexHash[:2], hexHash[2:]))
+	if err == nil {
+		defer fp.Close()
+		return readGitLooseObject(fp)
+	}
+
+	for _, pack := range r.packs {
+		if offset, ok := pack.find(hash); ok {
+			return pack.readObject(offset, r)
+		}
+	}
+	return 0, nil, fmt.Errorf("object not found: %s", hash)
+}
+
+// readBlob returns the content of a blob.
+func (r *gitRepository) readBlob(hash gitHash) ([]byte, error) {
+	objType, data, err := r.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != gitObjectBlob {
+		return nil, fmt.Errorf("%s is not a blob", hash)
+	}
+	return data, nil
+}
+
+func readGitLooseObject(r io.Reader) (int, []byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	nul := bytes.IndexByte(data, 0)
+	if nul < 0 {
+		return 0, nil, errors.New("invalid git object")
+	}
+	typeName, _, _ := strings.Cut(string(data[:nul]), " ")
+	objType := map[string]int{
+		"commit": gitObjectCommit,
+		"tree":   gitObjectTree,
+		"blob":   gitObjectBlob,
+		"tag":    gitObjectTag,
+	}[typeName]
+	if objType == 0 {
+		return 0, nil, fmt.Errorf("invalid git object type: %s", typeName)
+	}
+	return objType, data[nul+1:], nil
+}
+
+// gitPack reads the objects of a pack file by its version 2 index.
+type gitPack struct {
+	packFile     string
+	fanout       [256]uint32
+	hashes       []byte
+	offsets      []byte
+	largeOffsets []byte
+
+	mu    sync.Mutex
+	cache map[int64]gitPackObject
+}
+
+type gitPackObject struct {
+	objType int
+	data    []byte
+}
+
+func openGitPack(idxFile string) (*gitPack, error) {
+	data, err := os.ReadFile(idxFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return nil, fmt.Errorf("unsupported pack index: %s", idxFile)
+	}
+
+	p := &gitPack{
+		packFile: strings.TrimSuffix(idxFile, ".idx") + ".pack",
+		cache:    make(map[int64]gitPackObject),
+	}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(data[8+i*4:])
+	}
+	n := int(p.fanout[255])
+	pos := 8 + 256*4
+	if len(data) < pos+n*(20+4+4) {
+		return nil, fmt.Errorf("invalid pack index: %s", idxFile)
+	}
+	p.hashes = data[pos : pos+n*20]
+	pos += n * 20
+	pos += n * 4 // crc32
+	p.offsets = data[pos : pos+n*4]
+	p.largeOffsets = data[pos+n*4:]
+	return p, nil
+}
+
+// find returns the offset of the object in the pack file.
+func (p *gitPack) find(hash gitHash) (int64, bool) {
+	lo := 0
+	if hash[0] > 0 {
+		lo = int(p.fanout[hash[0]-1])
+	}
+	hi := int(p.fanout[hash[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.hashes[(lo+i)*20:(lo+i+1)*20], hash[:]) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.hashes[i*20:(i+1)*20], hash[:]) {
+		return 0, false
+	}
+
+	offset := int64(binary.BigEndian.Uint32(p.offsets[i*4:]))
+	if offset&0x80000000 != 0 {
+		large := int(offset&0x7fffffff) * 8
+		if large+8 > len(p.largeOffsets) {
+			return 0, false
+		}
+		offset = int64(binary.BigEndian.Uint64(p.largeOffsets[large:]))
+	}
+	return offset, true
+}
+
+// findPrefix returns the objects with the hex hash prefix.
+func (p *gitPack) findPrefix(prefix string) []gitHash {
+	var hashes []gitHash
+	for i := 0; i < len(p.hashes)/20; i++ {
+		if hexHash := hex.EncodeToString(p.hashes[i*20 : (i+1)*20]); strings.HasPrefix(hexHash, prefix) {
+			var hash gitHash
+			copy(hash[:], p.hashes[i*20:(i+1)*20])
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+// readObject returns the type and the content of the object at offset, the pack file is
+// opened for each object and its delta bases.
+func (p *gitPack) readObject(offset int64, repo *gitRepository) (int, []byte, error) {
+	p.mu.Lock()
+	obj, ok := p.cache[offset]
+	p.mu.Unlock()
+	if ok {
+		return obj.objType, obj.data, nil
+	}
+
+	fp, err := os.Open(p.packFile)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer fp.Close()
+	return p.readObjectAt(fp, offset, repo)
+}
+
+func (p *gitPack) readObjectAt(fp *os.File, offset int64, repo *gitRepository) (int, []byte, error) {
+	p.mu.Lock()
+	obj, ok := p.cache[offset]
+	p.mu.Unlock()
+	if ok {
+		return obj.objType, obj.data, nil
+	}
+
+	// the object header is the type and the inflated size, followed by the base of deltas
+	section := bufio.NewReader(io.NewSectionReader(fp, offset, 1<<62))
+	c, err := section.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	objType := int(c>>4) & 7
+	size := int64(c & 0x0f)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = section.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+		size |= int64(c&0x7f) << shift
+	}
+
+	var baseType int
+	var base []byte
+	switch objType {
+	case gitObjectOfsDelta:
+		c, err := section.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		distance := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = section.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			distance = (distance+1)<<7 | int64(c&0x7f)
+		}
+		if baseType, base, err = p.readObjectAt(fp, offset-distance, repo); err != nil {
+			return 0, nil, err
+		}
+	case gitObjectRefDelta:
+		var hash gitHash
+		if _, err := io.ReadFull(section, hash[:]); err != nil {
+			return 0, nil, err
+		}
+		if baseType, base, err = repo.readObject(hash); err != nil {
+			return 0, nil, err
+		}
+	case gitObjectCommit, gitObjectTree, gitObjectBlob, gitObjectTag:
+	default:
+		return 0, nil, fmt.Errorf("invalid pack object type: %d", objType)
+	}
+
+	zr, err := zlib.NewReader(section)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return 0, nil, err
+	}
+	if base != nil {
+		objType = baseType
+		if data, err = applyGitDelta(base, data); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	p.mu.Lock()
+	if len(p.cache) >= gitPackCacheSize {
+		p.cache = make(map[int64]gitPackObject)
+	}
+	p.cache[offset] = gitPackObject{objType: objType, data: data}
+	p.mu.Unlock()
+	return objType, data, nil
+}
+
+// applyGitDelta returns the object reconstructed from base and a delta of the pack file.
+func applyGitDelta(base, delta []byte) ([]byte, error) {
+	srcSize, n := binary.Uvarint(delta)
+	if n <= 0 || srcSize != uint64(len(base)) {
+		return nil, errors.New("invalid delta base size")
+	}
+	delta = delta[n:]
+	dstSize, n := binary.Uvarint(delta)
+	if n <= 0 {
+		return nil, errors.New("invalid delta size")
+	}
+	delta = delta[n:]
+
+	result := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		if op&0x80 == 0 {
+			// insert
+			if op == 0 || int(op) > len(delta) {
+				return nil, errors.New("invalid delta instruction")
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+			continue
+		}
+
+		// copy from base
+		var offset, size uint32
+		for i := 0; i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+			if len(delta) == 0 {
+				return nil, errors.New("invalid delta instruction")
+			}
+			if i < 4 {
+				offset |= uint32(delta[0]) << (8 * i)
+			} else {
+				size |= uint32(delta[0]) << (8 * (i - 4))
+			}
+			delta = delta[1:]
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if uint64(offset)+uint64(size) > uint64(len(base)) {
+			return nil, errors.New("invalid delta copy")
+		}
+		result = append(result, base[offset:offset+size]...)
+	}
+	if uint64(len(result)) != dstSize {
+		return nil, errors.New("invalid delta result size")
+	}
+	return result, nil
+}
+
+// gitOffsetVarint decodes the variable length integer of index v4 paths and pack offsets.
+func gitOffsetVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	val := uint64(b[0] & 0x7f)
+	n := 1
+	for b[n-1]&0x80 != 0 {
+		if n >= len(b) {
+			return 0, 0
+		}
+		val = (val+1)<<7 | uint64(b[n]&0x7f)
+		n++
+	}
+	return val, n
+}
+
+func gitHeaderHash(data []byte, header string) (gitHash, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, header+" ") {
+			return parseGitHash(strings.TrimPrefix(line, header+" "))
+		}
+	}
+	return gitHash{}, fmt.Errorf("no %s in git object", header)
+}
+
+func parseGitHash(s string) (gitHash, error) {
+	var hash gitHash
+	if len(s) != 40 {
+		return hash, fmt.Errorf("invalid object hash: %s", s)
+	}
+	_, err := hex.Decode(hash[:], []byte(s))
+	return hash, err
+}
+
+// gitFileInfo is the os.FileInfo of a git file.
+type gitFileInfo struct {
+	file gitFile
+}
+
+func (fi gitFileInfo) Name() string       { return filepath.Base(fi.file.path) }
+func (fi gitFileInfo) Size() int64        { return fi.file.size }
+func (fi gitFileInfo) Mode() os.FileMode  { return os.FileMode(fi.file.mode & 0o777) }
+func (fi gitFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi gitFileInfo) IsDir() bool        { return false }
+func (fi gitFileInfo) Sys() interface{}   { return nil }
+
+// getVCSFiles return the files to be analyzed in paths from the version control system.
+// With a revision, opts is set to read the files from the git objects.
+func getVCSFiles(paths []string, languages *DefinedLanguages, opts *ClocOptions) (map[string]*Language, error) {
+	if opts.VCS != "git" {
+		return nil, fmt.Errorf("unsupported vcs: %s", opts.VCS)
+	}
+
+	type blob struct {
+		repo *gitRepository
+		hash gitHash
+	}
+	blobs := make(map[string]blob)
+	if opts.Revision != "" {
+		opts.open = func(name string) (io.ReadCloser, error) {
+			b, ok := blobs[name]
+			if !ok {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+			}
+			data, err := b.repo.readBlob(b.hash)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+
+	result := make(map[string]*Language)
+	fileCache := make(map[string]struct{})
+	for _, root := range paths {
+		repo, err := openGitRepository(root)
+		if err != nil {
+			return nil, err
+		}
+		var files []gitFile
+		if opts.Revision != "" {
+			files, err = repo.revisionFiles(opts.Revision)
+		} else {
+			files, err = repo.indexFiles()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		prefix, err := filepath.Rel(repo.workTree, absRoot)
+		if err != nil {
+			return nil, err
+		}
+		prefix = filepath.ToSlash(prefix)
+
+		for _, file := range files {
+			if err := opts.context().Err(); err != nil {
+				return result, err
+			}
+			rel := file.path
+			if prefix != "." {
+				if rel != prefix && !strings.HasPrefix(rel, prefix+"/") {
+					continue
+				}
+				rel = strings.TrimPrefix(strings.TrimPrefix(rel, prefix), "/")
+			}
+			path := filepath.Join(root, filepath.FromSlash(rel))
+
+			if match := checkOptionMatch(path, gitFileInfo{file}, opts); !match {
+				continue
+			}
+			if opts.Revision != "" {
+				blobs[path] = blob{repo: repo, hash: file.hash}
+			}
+			addFile(result, path, languages, opts, fileCache)
+		}
+	}
+	return result, nil
+}
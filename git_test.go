@@ -0,0 +1,141 @@
+package ctoc
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v error. err=[%v] output=%s", args, err, output)
+	}
+	return string(output)
+}
+
+func analyzeGit(t *testing.T, root, revision string) *Result {
+	t.Helper()
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = wordTokenizer{}
+	clocOpts.SkipDuplicated = true
+	clocOpts.VCS = "git"
+	clocOpts.Revision = revision
+	result, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{root})
+	if err != nil {
+		t.Fatalf("Analyze() error. err=[%v]", err)
+	}
+	if clocOpts.open != nil {
+		t.Errorf("invalid logic, options of the caller are modified")
+	}
+	return result
+}
+
+func resultFiles(result *Result, root string) []string {
+	var files []string
+	for name := range result.Files {
+		rel, _ := filepath.Rel(root, name)
+		files = append(files, filepath.ToSlash(rel))
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestAnalyzeGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	writeTestFiles(t, dir, map[string]string{
+		"main.go":     "package main\n\nfunc main() {}\n",
+		"pkg/util.go": "package pkg\n",
+	})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	runGit(t, dir, "tag", "-a", "v1", "-m", "v1")
+
+	writeTestFiles(t, dir, map[string]string{
+		"main.go":        "package main\n\n// main function\nfunc main() {}\n",
+		"pkg/extra.py":   "print(1)\n",
+		"untracked.go":   "package main\n",
+		"pkg/ignored.go": "package pkg\n",
+	})
+	runGit(t, dir, "add", "main.go", "pkg/extra.py")
+	runGit(t, dir, "commit", "-q", "-m", "second")
+
+	// the index
+	result := analyzeGit(t, dir, "")
+	if files := resultFiles(result, dir); !reflect.DeepEqual(files, []string{"main.go", "pkg/extra.py", "pkg/util.go"}) {
+		t.Errorf("invalid index files. files=%v", files)
+	}
+	if result.Total.Comments != 1 {
+		t.Errorf("invalid logic. comments=%v", result.Total.Comments)
+	}
+	result = analyzeGit(t, filepath.Join(dir, "pkg"), "")
+	if files := resultFiles(result, filepath.Join(dir, "pkg")); !reflect.DeepEqual(files, []string{"extra.py", "util.go"}) {
+		t.Errorf("invalid index files in sub directory. files=%v", files)
+	}
+
+	// the files of revisions are read from the git objects, loose and packed
+	for _, gc := range []bool{false, true} {
+		if gc {
+			runGit(t, dir, "gc", "-q", "--aggressive")
+		}
+		first := runGit(t, dir, "rev-parse", "HEAD~1")[:7]
+		branch := strings.TrimSpace(runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"))
+		for _, revision := range []string{"HEAD~1", "HEAD^", "v1", branch + "~1", first} {
+			result = analyzeGit(t, dir, revision)
+			if files := resultFiles(result, dir); !reflect.DeepEqual(files, []string{"main.go", "pkg/util.go"}) {
+				t.Errorf("invalid files of revision. revision=%v files=%v", revision, files)
+			}
+			if result.Total.Comments != 0 || result.Total.Code != 3 || result.Total.Tokens != 7 {
+				t.Errorf("invalid logic. revision=%v total=%+v", revision, result.Total)
+			}
+		}
+		result = analyzeGit(t, dir, "HEAD:pkg")
+		if files := resultFiles(result, dir); !reflect.DeepEqual(files, []string{"extra.py", "util.go"}) {
+			t.Errorf("invalid files of tree. files=%v", files)
+		}
+	}
+
+	clocOpts := NewClocOptions()
+	clocOpts.VCS = "git"
+	clocOpts.Revision = "unknown"
+	if _, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{dir}); err == nil {
+		t.Errorf("invalid logic. expected error for unknown revision")
+	}
+	for _, revision := range []string{"HEAD^{tree}", "HEAD@{1}"} {
+		clocOpts.Revision = revision
+		if _, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{dir}); err == nil || !strings.Contains(err.Error(), "unsupported revision syntax") {
+			t.Errorf("invalid logic. revision=%v err=[%v]", revision, err)
+		}
+	}
+	clocOpts.VCS = "svn"
+	if _, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{dir}); err == nil {
+		t.Errorf("invalid logic. expected error for unsupported vcs")
+	}
+}
+
+func TestApplyGitDelta(t *testing.T) {
+	base := []byte("hello world")
+	// base size 11, result size 11: copy "hello " from offset 0, insert "gophe"
+	delta := []byte{11, 11, 0x90, 6, 5, 'g', 'o', 'p', 'h', 'e'}
+	result, err := applyGitDelta(base, delta)
+	if err != nil {
+		t.Fatalf("applyGitDelta() error. err=[%v]", err)
+	}
+	if string(result) != "hello gophe" {
+		t.Errorf("invalid logic. result=%q", result)
+	}
+
+	if _, err := applyGitDelta(base, []byte{10, 11}); err == nil {
+		t.Errorf("invalid logic. expected error for invalid base size")
+	}
+}
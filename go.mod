@@ -3,18 +3,20 @@ module github.com/yaohui-wyh/ctoc
 go 1.19
 
 require (
+	github.com/dlclark/regexp2 v1.10.0
 	github.com/go-enry/go-enry/v2 v2.8.6
 	github.com/jessevdk/go-flags v1.4.0
-	github.com/pkoukk/tiktoken-go v0.1.6
+	github.com/pkoukk/tiktoken-go v0.1.8
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
 	github.com/spf13/afero v1.2.2
+	golang.org/x/text v0.3.8
 	golang.org/x/tools v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/go-enry/go-oniguruma v1.2.1 // indirect
 	github.com/google/uuid v1.3.1 // indirect
 	golang.org/x/mod v0.13.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
-	golang.org/x/text v0.3.8 // indirect
 )
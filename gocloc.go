@@ -1,5 +1,15 @@
 package ctoc
 
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
 // Processor is gocloc analyzing processor.
 type Processor struct {
 	langs *DefinedLanguages
@@ -12,6 +22,11 @@ type Result struct {
 	Files         map[string]*ClocFile
 	Languages     map[string]*Language
 	MaxPathLength int
+	// Incomplete is set when the analysis is interrupted, the result only has the files analyzed before.
+	Incomplete bool
+
+	// opts reads the analyzed files again, e.g. to compare their lines in Diff.
+	opts *ClocOptions
 }
 
 // NewProcessor returns Processor.
@@ -23,12 +38,171 @@ func NewProcessor(langs *DefinedLanguages, options *ClocOptions) *Processor {
 }
 
 // Analyze executes gocloc parsing for the directory of the paths argument and returns the result.
+// The files of the archives in paths or in their directories are analyzed as archive!/path/in/archive,
+// the archives inside archives are not.
 func (p *Processor) Analyze(paths []string) (*Result, error) {
-	total := NewLanguage("TOTAL", []string{}, [][]string{{"", ""}})
-	languages, err := getAllFiles(paths, p.langs, p.opts)
+	return p.AnalyzeContext(context.Background(), paths)
+}
+
+// AnalyzeContext is Analyze, stopping when ctx is done. The result of the files analyzed
+// before is returned as Incomplete, along with the error of ctx.
+func (p *Processor) AnalyzeContext(ctx context.Context, paths []string) (*Result, error) {
+	// files may be read from the version control system or archives by a copy of the options
+	runOpts := *p.opts
+	opts := &runOpts
+	opts.ctx = ctx
+	languages, err := getAllFiles(paths, p.langs, opts)
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	result, err := analyze(languages, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result, ctx.Err()
+}
+
+// Walk executes gocloc parsing for the directory of the paths argument and calls fn with each file
+// as soon as it is analyzed, without keeping the results. fn is never called concurrently, the files
+// are in no particular order. Walk stops and returns the error when fn returns an error.
+func (p *Processor) Walk(paths []string, fn func(*ClocFile) error) error {
+	return p.WalkContext(context.Background(), paths, fn)
+}
+
+// WalkContext is Walk, stopping when ctx is done and returning the error of ctx.
+func (p *Processor) WalkContext(ctx context.Context, paths []string, fn func(*ClocFile) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runOpts := *p.opts
+	opts := &runOpts
+	opts.ctx = ctx
+	languages, err := getAllFiles(paths, p.langs, opts)
+	if err != nil {
+		return err
+	}
+
+	var fnErr error
+	analyzeFiles(languages, opts, func(language *Language, _ int, clocFile *ClocFile) {
+		if fnErr != nil {
+			return
+		}
+		clocFile.Lang = language.Name
+		if fnErr = fn(clocFile); fnErr != nil {
+			cancel()
+		}
+	})
+	if fnErr == nil {
+		fnErr = ctx.Err()
+	}
+
+	if opts.Cache != nil {
+		if err := opts.Cache.Save(); err != nil && fnErr == nil {
+			return err
+		}
+	}
+	return fnErr
+}
+
+// AnalyzeFS executes gocloc parsing for the roots in fsys and returns the result, the root of fsys
+// is analyzed when no roots are given. The ignore files in fsys are applied unless NoIgnore is set.
+func (p *Processor) AnalyzeFS(fsys fs.FS, roots ...string) (*Result, error) {
+	return p.AnalyzeFSContext(context.Background(), fsys, roots...)
+}
+
+// AnalyzeFSContext is AnalyzeFS, stopping when ctx is done. The result of the files analyzed
+// before is returned as Incomplete, along with the error of ctx.
+func (p *Processor) AnalyzeFSContext(ctx context.Context, fsys fs.FS, roots ...string) (*Result, error) {
+	runOpts := *p.opts
+	opts := &runOpts
+	opts.ctx = ctx
+	opts.open = func(name string) (io.ReadCloser, error) {
+		return fsys.Open(name)
+	}
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	languages, err := getFSFiles(fsys, roots, p.langs, opts)
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	result, err := analyze(languages, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result, ctx.Err()
+}
+
+// AnalyzeReader analyzes the content of r as the file name and returns the result.
+// The language is langName, or detected from the name and the content when langName is empty,
+// falling back to Plain Text.
+func (p *Processor) AnalyzeReader(name, langName string, r io.Reader) (*Result, error) {
+	return p.AnalyzeReaderContext(context.Background(), name, langName, r)
+}
+
+// AnalyzeReaderContext is AnalyzeReader, stopping when ctx is done. Reading r stops between two reads,
+// the error of ctx is returned without a result. The result of an interrupted analysis is returned as Incomplete,
+// along with the error of ctx.
+func (p *Processor) AnalyzeReaderContext(ctx context.Context, name, langName string, r io.Reader) (*Result, error) {
+	content, err := io.ReadAll(contextReader{ctx: ctx, r: r})
 	if err != nil {
 		return nil, err
 	}
+	runOpts := *p.opts
+	opts := &runOpts
+	opts.ctx = ctx
+	opts.open = func(filename string) (io.ReadCloser, error) {
+		if filename != name {
+			return nil, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
+		}
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+
+	lang := p.langs.Langs[langName]
+	if langName != "" && lang == nil {
+		for _, l := range p.langs.Langs {
+			if strings.EqualFold(l.Name, langName) {
+				lang = l
+				break
+			}
+		}
+		if lang == nil {
+			return nil, fmt.Errorf("unknown language: %s", langName)
+		}
+	} else if lang == nil {
+		lang = p.langs.Langs["Plain Text"]
+		if ext, ok := getFileType(name, opts); ok {
+			if l, ok := p.langs.Langs[Exts[ext]]; ok {
+				lang = l
+			}
+		}
+	}
+
+	language := NewLanguage(lang.Name, lang.lineComments, lang.multiLines)
+	language.Files = []string{name}
+	result, err := analyze(map[string]*Language{lang.Name: language}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result, ctx.Err()
+}
+
+// contextReader is r, failing with the error of ctx once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// analyze analyzes the files of languages and sums up their counts.
+func analyze(languages map[string]*Language, opts *ClocOptions) (*Result, error) {
+	total := NewLanguage("TOTAL", []string{}, [][]string{{"", ""}})
 	maxPathLen := 0
 	num := 0
 	for _, lang := range languages {
@@ -41,29 +215,59 @@ func (p *Processor) Analyze(paths []string) (*Result, error) {
 		}
 	}
 	clocFiles := make(map[string]*ClocFile, num)
+	analyzed := make(map[*Language][]*ClocFile, len(languages))
+	for _, language := range languages {
+		analyzed[language] = make([]*ClocFile, len(language.Files))
+	}
+	analyzeFiles(languages, opts, func(language *Language, index int, clocFile *ClocFile) {
+		analyzed[language][index] = clocFile
+	})
+	incomplete := opts.context().Err() != nil
 
 	for _, language := range languages {
-		for _, file := range language.Files {
-			cf := AnalyzeFile(file, language, p.opts)
+		files := language.Files[:0]
+		for i, file := range language.Files {
+			cf := analyzed[language][i]
+			if cf == nil {
+				// not analyzed before the analysis is interrupted
+				continue
+			}
+			files = append(files, file)
 			cf.Lang = language.Name
 
 			language.Code += cf.Code
 			language.Comments += cf.Comments
 			language.Blanks += cf.Blanks
 			language.Tokens += cf.Tokens
+			language.CodeTokens += cf.CodeTokens
+			language.CommentTokens += cf.CommentTokens
+			language.BlankTokens += cf.BlankTokens
+			language.TokensError += cf.TokensError
+			language.EncodingTokens.add(cf.EncodingTokens)
 			clocFiles[file] = cf
 		}
+		language.Files = files
 
-		files := int32(len(language.Files))
 		if len(language.Files) <= 0 {
 			continue
 		}
 
-		total.Total += files
+		total.Total += int32(len(language.Files))
 		total.Blanks += language.Blanks
 		total.Comments += language.Comments
 		total.Code += language.Code
 		total.Tokens += language.Tokens
+		total.CodeTokens += language.CodeTokens
+		total.CommentTokens += language.CommentTokens
+		total.BlankTokens += language.BlankTokens
+		total.TokensError += language.TokensError
+		total.EncodingTokens.add(language.EncodingTokens)
+	}
+
+	if opts.Cache != nil {
+		if err := opts.Cache.Save(); err != nil {
+			return nil, err
+		}
 	}
 
 	return &Result{
@@ -71,5 +275,82 @@ func (p *Processor) Analyze(paths []string) (*Result, error) {
 		Files:         clocFiles,
 		Languages:     languages,
 		MaxPathLength: maxPathLen,
+		Incomplete:    incomplete,
+		opts:          opts,
 	}, nil
 }
+
+// analyzeFiles analyzes every file of languages, using up to opts.Jobs goroutines, and calls fn with
+// the index of each analyzed file in Language.Files as soon as it is analyzed. fn is called in the
+// goroutine of the caller, it is not called for the files not analyzed before the analysis is interrupted.
+func analyzeFiles(languages map[string]*Language, opts *ClocOptions, fn func(language *Language, index int, clocFile *ClocFile)) {
+	type fileJob struct {
+		language *Language
+		index    int
+		clocFile *ClocFile
+	}
+
+	ctx := opts.context()
+	analyzeFile := func(file string, language *Language) *ClocFile {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if clocFile, ok := opts.archived[file]; ok {
+			return clocFile
+		}
+		clocFile := AnalyzeFile(file, language, opts)
+		if ctx.Err() != nil {
+			// the file may be analyzed partially
+			return nil
+		}
+		return clocFile
+	}
+
+	if opts.Jobs <= 1 {
+		for _, language := range languages {
+			for i, file := range language.Files {
+				if clocFile := analyzeFile(file, language); clocFile != nil {
+					fn(language, i, clocFile)
+				}
+			}
+		}
+		return
+	}
+
+	jobs := make(chan fileJob)
+	analyzed := make(chan fileJob)
+	go func() {
+		defer close(jobs)
+		for _, language := range languages {
+			for i := range language.Files {
+				select {
+				case jobs <- fileJob{language: language, index: i}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				job.clocFile = analyzeFile(job.language.Files[job.index], job.language)
+				analyzed <- job
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(analyzed)
+	}()
+
+	for job := range analyzed {
+		if job.clocFile != nil {
+			fn(job.language, job.index, job.clocFile)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package ctoc
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAnalyzeWithJobs(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		content := fmt.Sprintf("package main\n\n// file %d\nfunc f%d() {}\n", i, i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.go", i)), []byte(content), 0o644); err != nil {
+			t.Fatalf("os.WriteFile() error. err=[%v]", err)
+		}
+		content = fmt.Sprintf("# file %d\nprint(%d)\n", i, i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.py", i)), []byte(content), 0o644); err != nil {
+			t.Fatalf("os.WriteFile() error. err=[%v]", err)
+		}
+	}
+
+	clocOpts := NewClocOptions()
+	expected, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{dir})
+	if err != nil {
+		t.Fatalf("Analyze() error. err=[%v]", err)
+	}
+
+	clocOpts.Jobs = 4
+	actual, err := NewProcessor(NewDefinedLanguages(), clocOpts).Analyze([]string{dir})
+	if err != nil {
+		t.Fatalf("Analyze() error. err=[%v]", err)
+	}
+
+	if actual.Total.Tokens != expected.Total.Tokens || actual.Total.Code != expected.Total.Code || actual.Total.Total != expected.Total.Total {
+		t.Errorf("invalid total. expected=%+v actual=%+v", expected.Total, actual.Total)
+	}
+	if len(actual.Files) != 40 {
+		t.Errorf("invalid files. files=%v", len(actual.Files))
+	}
+	for name, cf := range expected.Files {
+		if !reflect.DeepEqual(actual.Files[name], cf) {
+			t.Errorf("invalid file result. expected=%+v actual=%+v", cf, actual.Files[name])
+		}
+	}
+	for name, lang := range expected.Languages {
+		if actual.Languages[name].Tokens != lang.Tokens || actual.Languages[name].Code != lang.Code {
+			t.Errorf("invalid language result. expected=%+v actual=%+v", lang, actual.Languages[name])
+		}
+	}
+}
+
+func TestProcessorAnalyzeReader(t *testing.T) {
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = wordTokenizer{}
+	processor := NewProcessor(NewDefinedLanguages(), clocOpts)
+
+	tests := []struct {
+		name     string
+		langName string
+		content  string
+		lang     string
+		comments int32
+	}{
+		{"main.go", "", "package main\n\n// main\nfunc main() {}\n", "Go", 1},
+		{"stdin", "", "#!/usr/bin/env python\n# comment\nprint(1)\n", "Python", 1},
+		{"stdin", "", "# not a comment\n", "Plain Text", 0},
+		{"prompt.txt", "python", "# comment\nprint(1)\n", "Python", 1},
+	}
+	for _, test := range tests {
+		result, err := processor.AnalyzeReader(test.name, test.langName, strings.NewReader(test.content))
+		if err != nil {
+			t.Fatalf("AnalyzeReader() error. err=[%v]", err)
+		}
+		file, ok := result.Files[test.name]
+		if !ok || len(result.Files) != 1 {
+			t.Fatalf("invalid logic. files=%v", result.Files)
+		}
+		if file.Lang != test.lang || file.Comments != test.comments || result.Total.Total != 1 {
+			t.Errorf("invalid logic. name=%v file=%+v", test.name, file)
+		}
+		if result.Languages[test.lang].Tokens != file.Tokens || result.Total.Tokens != file.Tokens {
+			t.Errorf("invalid logic. tokens are not summed up. result=%+v", result.Total)
+		}
+	}
+
+	if _, err := processor.AnalyzeReader("stdin", "unknown", strings.NewReader("")); err == nil {
+		t.Errorf("invalid logic. expected error for unknown language")
+	}
+}
+
+func TestProcessorAnalyzeReaderContext(t *testing.T) {
+	content := "package main\n// comment\nfunc main() {}\n"
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	processor := NewProcessor(NewDefinedLanguages(), NewClocOptions())
+	if result, err := processor.AnalyzeReaderContext(ctx, "main.go", "", strings.NewReader(content)); err != context.Canceled || result != nil {
+		t.Errorf("invalid logic. err=[%v] result=%+v", err, result)
+	}
+
+	// the file partially analyzed is not in the result
+	var calls int32
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = cancelTokenizer{calls: &calls, n: 1, cancel: cancel}
+	result, err := NewProcessor(NewDefinedLanguages(), clocOpts).AnalyzeReaderContext(ctx, "main.go", "", strings.NewReader(content))
+	if err != context.Canceled || !result.Incomplete || len(result.Files) != 0 {
+		t.Errorf("invalid logic. err=[%v] result=%+v", err, result)
+	}
+}
+
+func TestProcessorAnalyzeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/main.go":      {Data: []byte("package main\n\n// main\nfunc main() {}\n")},
+		"src/copy.go":      {Data: []byte("package main\n\n// main\nfunc main() {}\n")},
+		"src/run":          {Data: []byte("#!/usr/bin/env python\n# comment\nprint(1)\n")},
+		"src/.git/HEAD.go": {Data: []byte("package git\n")},
+		"docs/README.md":   {Data: []byte("# ctoc\n")},
+	}
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = wordTokenizer{}
+	processor := NewProcessor(NewDefinedLanguages(), clocOpts)
+
+	result, err := processor.AnalyzeFS(fsys)
+	if err != nil {
+		t.Fatalf("AnalyzeFS() error. err=[%v]", err)
+	}
+	// the duplicated file is skipped
+	if result.Total.Total != 3 || len(result.Languages["Go"].Files) != 1 {
+		t.Errorf("invalid logic. files=%v", result.Files)
+	}
+	if file, ok := result.Files["src/run"]; !ok || file.Lang != "Python" || file.Comments != 1 {
+		t.Errorf("invalid logic. file=%+v", file)
+	}
+
+	result, err = processor.AnalyzeFS(fsys, "docs")
+	if err != nil {
+		t.Fatalf("AnalyzeFS() error. err=[%v]", err)
+	}
+	if _, ok := result.Files["docs/README.md"]; !ok || len(result.Files) != 1 {
+		t.Errorf("invalid logic. files=%v", result.Files)
+	}
+
+	if _, err := processor.AnalyzeFS(fsys, "/src"); err == nil {
+		t.Errorf("invalid logic. expected error for invalid root")
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("pkg/util.go")
+	if err != nil {
+		t.Fatalf("Create() error. err=[%v]", err)
+	}
+	if _, err := w.Write([]byte("package pkg\n")); err != nil {
+		t.Fatalf("Write() error. err=[%v]", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close() error. err=[%v]", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error. err=[%v]", err)
+	}
+	result, err = processor.AnalyzeFS(zr)
+	if err != nil {
+		t.Fatalf("AnalyzeFS() error. err=[%v]", err)
+	}
+	if file, ok := result.Files["pkg/util.go"]; !ok || file.Code != 1 || file.Tokens != 2 {
+		t.Errorf("invalid logic. files=%v", result.Files)
+	}
+}
+
+func TestProcessorAnalyzeFSIgnore(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitignore":          {Data: []byte("build/\n*.gen.go\n")},
+		".git/info/exclude":   {Data: []byte("local.go\n")},
+		"src/.ctocignore":     {Data: []byte("vendor\n!keep.gen.go\n")},
+		"src/main.go":         {Data: []byte("package main\n")},
+		"src/local.go":        {Data: []byte("package main\n\nvar a = 1\n")},
+		"src/api.gen.go":      {Data: []byte("package main\n\nvar b = 1\n")},
+		"src/keep.gen.go":     {Data: []byte("package main\n\nvar c = 1\n")},
+		"src/vendor/lib.go":   {Data: []byte("package lib\n")},
+		"build/out.go":        {Data: []byte("package out\n")},
+		"build/nested/out.go": {Data: []byte("package nested\n")},
+	}
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = wordTokenizer{}
+	clocOpts.SkipDuplicated = true
+
+	for _, root := range []string{".", "src"} {
+		result, err := NewProcessor(NewDefinedLanguages(), clocOpts).AnalyzeFS(fsys, root)
+		if err != nil {
+			t.Fatalf("AnalyzeFS() error. err=[%v]", err)
+		}
+		var files []string
+		for file := range result.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		if expected := []string{"src/keep.gen.go", "src/main.go"}; !reflect.DeepEqual(files, expected) {
+			t.Errorf("invalid files. root=%v files=%v", root, files)
+		}
+	}
+
+	clocOpts.NoIgnore = true
+	result, err := NewProcessor(NewDefinedLanguages(), clocOpts).AnalyzeFS(fsys)
+	if err != nil {
+		t.Fatalf("AnalyzeFS() error. err=[%v]", err)
+	}
+	if len(result.Files) != 7 {
+		t.Errorf("invalid logic, ignore files are applied with NoIgnore. files=%v", result.Files)
+	}
+}
+
+func TestProcessorAnalyzeFSContext(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := 0; i < 5; i++ {
+		fsys[fmt.Sprintf("f%d.go", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("package main\n// file %d\n", i))}
+	}
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = wordTokenizer{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := NewProcessor(NewDefinedLanguages(), clocOpts).AnalyzeFSContext(ctx, fsys)
+	if err != context.Canceled || !result.Incomplete || len(result.Files) != 0 {
+		t.Errorf("invalid logic, analyzed after cancel. err=[%v] files=%v", err, result.Files)
+	}
+
+	// cancelled while analyzing the second file
+	var calls int32
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	clocOpts.Jobs = 1
+	clocOpts.Tokenizer = cancelTokenizer{calls: &calls, n: 3, cancel: cancel}
+	result, err = NewProcessor(NewDefinedLanguages(), clocOpts).AnalyzeFSContext(ctx, fsys)
+	if err != context.Canceled || !result.Incomplete || len(result.Files) != 1 {
+		t.Errorf("invalid logic. err=[%v] files=%v", err, result.Files)
+	}
+}
+
+// cancelTokenizer is a wordTokenizer cancelling the analysis on the n-th call of Count.
+type cancelTokenizer struct {
+	wordTokenizer
+	calls  *int32
+	n      int32
+	cancel context.CancelFunc
+}
+
+func (c cancelTokenizer) Count(text string) int {
+	if atomic.AddInt32(c.calls, 1) == c.n {
+		c.cancel()
+	}
+	return c.wordTokenizer.Count(text)
+}
+
+func TestAnalyzeContext(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		content := fmt.Sprintf("package main\n// file %d\n", i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.go", i)), []byte(content), 0o644); err != nil {
+			t.Fatalf("os.WriteFile() error. err=[%v]", err)
+		}
+	}
+	cacheDir := t.TempDir()
+
+	analyze := func(ctx context.Context, tokenizer Tokenizer) (*Result, error) {
+		cache, err := OpenCache(cacheDir, "v1")
+		if err != nil {
+			t.Fatalf("OpenCache() error. err=[%v]", err)
+		}
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = tokenizer
+		clocOpts.Jobs = 1
+		clocOpts.Cache = cache
+		return NewProcessor(NewDefinedLanguages(), clocOpts).AnalyzeContext(ctx, []string{dir})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := analyze(ctx, wordTokenizer{})
+	if err != context.Canceled || !result.Incomplete || len(result.Files) != 0 {
+		t.Errorf("invalid logic, analyzed after cancel. err=[%v] files=%v", err, result.Files)
+	}
+
+	// cancelled while analyzing the second file
+	var calls int32
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	result, err = analyze(ctx, cancelTokenizer{calls: &calls, n: 3, cancel: cancel})
+	if err != context.Canceled || !result.Incomplete {
+		t.Fatalf("invalid logic. err=[%v] result=%+v", err, result)
+	}
+	if _, ok := result.Files[filepath.Join(dir, "f0.go")]; !ok || len(result.Files) != 1 {
+		t.Errorf("invalid logic, partially analyzed file is in the result. files=%v", result.Files)
+	}
+	if result.Total.Total != 1 || len(result.Languages["Go"].Files) != 1 || result.Total.Code != 1 || result.Total.Comments != 1 {
+		t.Errorf("invalid logic. total=%+v", result.Total)
+	}
+
+	// the partially analyzed file is not cached
+	calls = 0
+	result, err = analyze(context.Background(), countingTokenizer{calls: &calls})
+	if err != nil || result.Incomplete || len(result.Files) != 5 {
+		t.Fatalf("invalid logic. err=[%v] result=%+v", err, result)
+	}
+	if calls != 8 {
+		t.Errorf("invalid logic, cached files are analyzed again. calls=%v", calls)
+	}
+}
+
+func TestProcessorWalk(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		content := fmt.Sprintf("package main\n\n// file %d\nfunc f%d() {}\n", i, i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.go", i)), []byte(content), 0o644); err != nil {
+			t.Fatalf("os.WriteFile() error. err=[%v]", err)
+		}
+	}
+
+	for _, jobs := range []int{1, 4} {
+		clocOpts := NewClocOptions()
+		clocOpts.Tokenizer = wordTokenizer{}
+		clocOpts.Jobs = jobs
+		processor := NewProcessor(NewDefinedLanguages(), clocOpts)
+		expected, err := processor.Analyze([]string{dir})
+		if err != nil {
+			t.Fatalf("Analyze() error. err=[%v]", err)
+		}
+
+		files := make(map[string]*ClocFile)
+		err = processor.Walk([]string{dir}, func(file *ClocFile) error {
+			files[file.Name] = file
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Walk() error. err=[%v]", err)
+		}
+		if !reflect.DeepEqual(files, expected.Files) {
+			t.Errorf("invalid logic. jobs=%v files=%v", jobs, files)
+		}
+
+		// stop by the error of the callback
+		stop := fmt.Errorf("stop")
+		count := 0
+		err = processor.Walk([]string{dir}, func(file *ClocFile) error {
+			count++
+			if count == 3 {
+				return stop
+			}
+			return nil
+		})
+		if err != stop || count != 3 {
+			t.Errorf("invalid logic, walk is not stopped. jobs=%v err=[%v] count=%v", jobs, err, count)
+		}
+	}
+}
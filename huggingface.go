@@ -0,0 +1,439 @@
+package ctoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dlclark/regexp2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// gpt2Pattern is the pre-tokenizer regular expression of the ByteLevel pre-tokenizer.
+const gpt2Pattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+
+// HFTokenizer is a Tokenizer for the BPE model of a HuggingFace tokenizer.json file.
+// Added tokens and post-processors (e.g. BOS tokens) are not applied.
+type HFTokenizer struct {
+	name         string
+	digest       string
+	vocab        map[string]int
+	ranks        map[[2]string]int
+	normalizers  []func(string) string
+	preTokenizer func(string) []string
+	byteLevel    bool
+	byteFallback bool
+	ignoreMerges bool
+	unkID        int
+}
+
+type hfTokenizerJSON struct {
+	Normalizer   *hfComponent `json:"normalizer"`
+	PreTokenizer *hfComponent `json:"pre_tokenizer"`
+	Model        struct {
+		Type         string            `json:"type"`
+		Vocab        map[string]int    `json:"vocab"`
+		Merges       []json.RawMessage `json:"merges"`
+		UnkToken     *string           `json:"unk_token"`
+		ByteFallback bool              `json:"byte_fallback"`
+		IgnoreMerges bool              `json:"ignore_merges"`
+	} `json:"model"`
+}
+
+// hfComponent is a normalizer or pre-tokenizer definition of tokenizer.json.
+type hfComponent struct {
+	Type          string         `json:"type"`
+	Normalizers   []*hfComponent `json:"normalizers"`
+	PreTokenizers []*hfComponent `json:"pretokenizers"`
+	Pattern       struct {
+		String *string `json:"String"`
+		Regex  *string `json:"Regex"`
+	} `json:"pattern"`
+	Content          string `json:"content"`
+	Prepend          string `json:"prepend"`
+	Behavior         string `json:"behavior"`
+	Invert           bool   `json:"invert"`
+	AddPrefixSpace   *bool  `json:"add_prefix_space"`
+	UseRegex         *bool  `json:"use_regex"`
+	Replacement      string `json:"replacement"`
+	PrependScheme    string `json:"prepend_scheme"`
+	Split            *bool  `json:"split"`
+	IndividualDigits bool   `json:"individual_digits"`
+}
+
+// NewHFTokenizer returns HFTokenizer for a HuggingFace tokenizer.json file.
+// The tokenizer is named after its directory when the file is named tokenizer.json.
+func NewHFTokenizer(filename string) (*HFTokenizer, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := parseHFTokenizer(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	t.name = tokenizerNameFromFile(filename)
+	t.digest = contentDigest(content)
+	return t, nil
+}
+
+func parseHFTokenizer(content []byte) (*HFTokenizer, error) {
+	var tj hfTokenizerJSON
+	if err := json.Unmarshal(content, &tj); err != nil {
+		return nil, err
+	}
+	if tj.Model.Type != "BPE" && !(tj.Model.Type == "" && len(tj.Model.Merges) > 0) {
+		return nil, fmt.Errorf("unsupported model type %q, only BPE is supported", tj.Model.Type)
+	}
+
+	t := &HFTokenizer{
+		vocab:        tj.Model.Vocab,
+		ranks:        make(map[[2]string]int, len(tj.Model.Merges)),
+		byteFallback: tj.Model.ByteFallback,
+		ignoreMerges: tj.Model.IgnoreMerges,
+		unkID:        -1,
+	}
+	if tj.Model.UnkToken != nil {
+		if id, ok := t.vocab[*tj.Model.UnkToken]; ok {
+			t.unkID = id
+		}
+	}
+
+	for rank, raw := range tj.Model.Merges {
+		var pair [2]string
+		var merge string
+		if err := json.Unmarshal(raw, &merge); err == nil {
+			left, right, ok := strings.Cut(merge, " ")
+			if !ok {
+				return nil, fmt.Errorf("invalid merge: %q", merge)
+			}
+			pair = [2]string{left, right}
+		} else if err := json.Unmarshal(raw, &pair); err != nil {
+			return nil, fmt.Errorf("invalid merge: %s", raw)
+		}
+		if _, ok := t.ranks[pair]; !ok {
+			t.ranks[pair] = rank
+		}
+	}
+
+	if tj.Normalizer != nil {
+		normalizers, err := hfNormalizers(tj.Normalizer)
+		if err != nil {
+			return nil, err
+		}
+		t.normalizers = normalizers
+	}
+
+	preTokenizers := []func(string) []string{}
+	if tj.PreTokenizer != nil {
+		var err error
+		preTokenizers, err = t.hfPreTokenizers(tj.PreTokenizer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.preTokenizer = func(text string) []string {
+		pieces := []string{text}
+		for _, preTokenize := range preTokenizers {
+			var next []string
+			for _, piece := range pieces {
+				next = append(next, preTokenize(piece)...)
+			}
+			pieces = next
+		}
+		return pieces
+	}
+
+	return t, nil
+}
+
+func hfNormalizers(c *hfComponent) ([]func(string) string, error) {
+	switch c.Type {
+	case "Sequence":
+		var normalizers []func(string) string
+		for _, n := range c.Normalizers {
+			sub, err := hfNormalizers(n)
+			if err != nil {
+				return nil, err
+			}
+			normalizers = append(normalizers, sub...)
+		}
+		return normalizers, nil
+	case "Prepend":
+		return []func(string) string{func(s string) string {
+			if s == "" {
+				return s
+			}
+			return c.Prepend + s
+		}}, nil
+	case "Replace":
+		if c.Pattern.String != nil {
+			from := *c.Pattern.String
+			return []func(string) string{func(s string) string {
+				return strings.ReplaceAll(s, from, c.Content)
+			}}, nil
+		}
+		if c.Pattern.Regex != nil {
+			re, err := regexp2.Compile(*c.Pattern.Regex, regexp2.None)
+			if err != nil {
+				return nil, err
+			}
+			return []func(string) string{func(s string) string {
+				if r, err := re.Replace(s, c.Content, -1, -1); err == nil {
+					return r
+				}
+				return s
+			}}, nil
+		}
+		return nil, fmt.Errorf("invalid Replace normalizer")
+	case "NFC":
+		return []func(string) string{norm.NFC.String}, nil
+	case "NFD":
+		return []func(string) string{norm.NFD.String}, nil
+	case "NFKC":
+		return []func(string) string{norm.NFKC.String}, nil
+	case "NFKD":
+		return []func(string) string{norm.NFKD.String}, nil
+	case "Lowercase":
+		return []func(string) string{strings.ToLower}, nil
+	default:
+		return nil, fmt.Errorf("unsupported normalizer type: %s", c.Type)
+	}
+}
+
+func (t *HFTokenizer) hfPreTokenizers(c *hfComponent) ([]func(string) []string, error) {
+	switch c.Type {
+	case "Sequence":
+		var preTokenizers []func(string) []string
+		for _, p := range c.PreTokenizers {
+			sub, err := t.hfPreTokenizers(p)
+			if err != nil {
+				return nil, err
+			}
+			preTokenizers = append(preTokenizers, sub...)
+		}
+		return preTokenizers, nil
+	case "Split":
+		if c.Invert {
+			return nil, fmt.Errorf("unsupported inverted Split pre-tokenizer")
+		}
+		var pattern string
+		if c.Pattern.Regex != nil {
+			pattern = *c.Pattern.Regex
+		} else if c.Pattern.String != nil {
+			pattern = regexp2.Escape(*c.Pattern.String)
+		} else {
+			return nil, fmt.Errorf("invalid Split pre-tokenizer")
+		}
+		re, err := regexp2.Compile(pattern, regexp2.None)
+		if err != nil {
+			return nil, err
+		}
+		return []func(string) []string{func(s string) []string {
+			return splitByRegexp(re, s, c.Behavior)
+		}}, nil
+	case "ByteLevel":
+		t.byteLevel = true
+		var preTokenizers []func(string) []string
+		if c.AddPrefixSpace != nil && *c.AddPrefixSpace {
+			preTokenizers = append(preTokenizers, func(s string) []string {
+				if strings.HasPrefix(s, " ") {
+					return []string{s}
+				}
+				return []string{" " + s}
+			})
+		}
+		if c.UseRegex == nil || *c.UseRegex {
+			re := regexp2.MustCompile(gpt2Pattern, regexp2.None)
+			preTokenizers = append(preTokenizers, func(s string) []string {
+				return splitByRegexp(re, s, "Isolated")
+			})
+		}
+		return preTokenizers, nil
+	case "Metaspace":
+		replacement := c.Replacement
+		if replacement == "" {
+			replacement = "▁"
+		}
+		prepend := c.PrependScheme != "never"
+		if c.PrependScheme == "" && c.AddPrefixSpace != nil {
+			prepend = *c.AddPrefixSpace
+		}
+		split := c.Split == nil || *c.Split
+		return []func(string) []string{func(s string) []string {
+			s = strings.ReplaceAll(s, " ", replacement)
+			if prepend && !strings.HasPrefix(s, replacement) {
+				s = replacement + s
+			}
+			if !split {
+				return []string{s}
+			}
+			parts := strings.Split(s, replacement)
+			pieces := appendNonEmpty(nil, parts[0])
+			for _, part := range parts[1:] {
+				pieces = append(pieces, replacement+part)
+			}
+			return pieces
+		}}, nil
+	case "Digits":
+		pattern := `\p{N}+`
+		if c.IndividualDigits {
+			pattern = `\p{N}`
+		}
+		re := regexp2.MustCompile(pattern, regexp2.None)
+		return []func(string) []string{func(s string) []string {
+			return splitByRegexp(re, s, "Isolated")
+		}}, nil
+	case "Whitespace":
+		re := regexp2.MustCompile(`\w+|[^\w\s]+`, regexp2.None)
+		return []func(string) []string{func(s string) []string {
+			var pieces []string
+			for m, _ := re.FindStringMatch(s); m != nil; m, _ = re.FindNextMatch(m) {
+				pieces = append(pieces, m.String())
+			}
+			return pieces
+		}}, nil
+	case "WhitespaceSplit":
+		return []func(string) []string{strings.Fields}, nil
+	default:
+		return nil, fmt.Errorf("unsupported pre_tokenizer type: %s", c.Type)
+	}
+}
+
+// splitByRegexp splits s into the matches of re and the text between them by the Split behavior.
+func splitByRegexp(re *regexp2.Regexp, s string, behavior string) []string {
+	runes := []rune(s)
+	var pieces []string
+	// pending is the match merged with the next piece
+	var pending string
+	pos := 0
+	for m, _ := re.FindStringMatch(s); m != nil; m, _ = re.FindNextMatch(m) {
+		gap := string(runes[pos:m.Index])
+		match := string(runes[m.Index : m.Index+m.Length])
+		pos = m.Index + m.Length
+		switch behavior {
+		case "Removed":
+			pieces = appendNonEmpty(pieces, gap)
+		case "MergedWithPrevious":
+			pieces = appendNonEmpty(pieces, gap+match)
+		case "MergedWithNext":
+			pieces = appendNonEmpty(pieces, pending+gap)
+			pending = match
+		default:
+			pieces = appendNonEmpty(pieces, gap)
+			pieces = appendNonEmpty(pieces, match)
+		}
+	}
+	return appendNonEmpty(pieces, pending+string(runes[pos:]))
+}
+
+func appendNonEmpty(pieces []string, s string) []string {
+	if s == "" {
+		return pieces
+	}
+	return append(pieces, s)
+}
+
+// Encode returns the token ids for text.
+func (t *HFTokenizer) Encode(text string) []int {
+	for _, normalize := range t.normalizers {
+		text = normalize(text)
+	}
+
+	var ids []int
+	for _, piece := range t.preTokenizer(text) {
+		if t.byteLevel {
+			piece = bytesToUnicode(piece)
+		}
+		ids = append(ids, t.encodePiece(piece)...)
+	}
+	return ids
+}
+
+// Count returns the number of tokens for text.
+func (t *HFTokenizer) Count(text string) int {
+	return len(t.Encode(text))
+}
+
+// Name returns the tokenizer name.
+func (t *HFTokenizer) Name() string {
+	return t.name
+}
+
+func (t *HFTokenizer) definitionDigest() string {
+	return t.digest
+}
+
+func (t *HFTokenizer) encodePiece(piece string) []int {
+	if t.ignoreMerges {
+		if id, ok := t.vocab[piece]; ok {
+			return []int{id}
+		}
+	}
+
+	var symbols []string
+	for _, r := range piece {
+		symbols = append(symbols, string(r))
+	}
+	for len(symbols) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i < len(symbols)-1; i++ {
+			if rank, ok := t.ranks[[2]string{symbols[i], symbols[i+1]}]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		symbols[best] += symbols[best+1]
+		symbols = append(symbols[:best+1], symbols[best+2:]...)
+	}
+
+	ids := make([]int, 0, len(symbols))
+	for _, symbol := range symbols {
+		if id, ok := t.vocab[symbol]; ok {
+			ids = append(ids, id)
+			continue
+		}
+		if t.byteFallback {
+			for _, b := range []byte(symbol) {
+				if id, ok := t.vocab[fmt.Sprintf("<0x%02X>", b)]; ok {
+					ids = append(ids, id)
+				} else {
+					ids = append(ids, t.unkID)
+				}
+			}
+			continue
+		}
+		ids = append(ids, t.unkID)
+	}
+	return ids
+}
+
+var byteEncoder = newByteEncoder()
+
+// newByteEncoder returns the GPT-2 mapping of bytes to printable unicode characters.
+func newByteEncoder() [256]rune {
+	var encoder [256]rune
+	n := 0
+	for b := 0; b < 256; b++ {
+		r := rune(b)
+		if (r >= '!' && r <= '~') || (r >= '¡' && r <= '¬') || (r >= '®' && r <= 'ÿ') {
+			encoder[b] = r
+		} else {
+			encoder[b] = rune(256 + n)
+			n++
+		}
+	}
+	return encoder
+}
+
+func bytesToUnicode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		sb.WriteRune(byteEncoder[s[i]])
+	}
+	return sb.String()
+}
@@ -0,0 +1,98 @@
+package ctoc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testByteLevelVocab = `{"h":0,"e":1,"l":2,"o":3,"Ġ":4,"w":5,"r":6,"d":7,"he":8,"ll":9,"hell":10,"hello":11,"Ġw":12,"or":13,"Ġwor":14,"Ġworl":15,"Ġworld":16}`
+
+const testByteLevelMerges = `["h e","l l","he ll","hell o","Ġ w","o r","Ġw or","Ġwor l","Ġworl d"]`
+
+func writeHFTokenizer(t *testing.T, content string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "test-model")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("os.Mkdir() error. err=[%v]", err)
+	}
+	filename := filepath.Join(dir, "tokenizer.json")
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error. err=[%v]", err)
+	}
+	return filename
+}
+
+func TestHFTokenizerByteLevel(t *testing.T) {
+	filename := writeHFTokenizer(t, `{
+		"pre_tokenizer": {"type": "ByteLevel", "add_prefix_space": false, "use_regex": true},
+		"model": {"type": "BPE", "vocab": `+testByteLevelVocab+`, "merges": `+testByteLevelMerges+`}
+	}`)
+
+	tokenizer, err := NewHFTokenizer(filename)
+	if err != nil {
+		t.Fatalf("NewHFTokenizer() error. err=[%v]", err)
+	}
+	if tokenizer.Name() != "test-model" {
+		t.Errorf("invalid name. name=%v", tokenizer.Name())
+	}
+	if ids := tokenizer.Encode("hello world"); !reflect.DeepEqual(ids, []int{11, 16}) {
+		t.Errorf("invalid logic. ids=%v", ids)
+	}
+	// "!" is unknown, "hel" is not merged into a single token
+	if n := tokenizer.Count("hel world!"); n != 4 {
+		t.Errorf("invalid logic. tokens=%v", n)
+	}
+}
+
+func TestHFTokenizerSplitSequence(t *testing.T) {
+	filename := writeHFTokenizer(t, `{
+		"normalizer": {"type": "NFC"},
+		"pre_tokenizer": {"type": "Sequence", "pretokenizers": [
+			{"type": "Split", "pattern": {"Regex": " ?\\p{L}+|\\s+(?!\\S)|\\s+"}, "behavior": "Isolated", "invert": false},
+			{"type": "ByteLevel", "add_prefix_space": false, "use_regex": false}
+		]},
+		"model": {"type": "BPE", "vocab": `+testByteLevelVocab+`, "merges": `+testByteLevelMerges+`}
+	}`)
+
+	tokenizer, err := NewHFTokenizer(filename)
+	if err != nil {
+		t.Fatalf("NewHFTokenizer() error. err=[%v]", err)
+	}
+	if ids := tokenizer.Encode("hello world world"); !reflect.DeepEqual(ids, []int{11, 16, 16}) {
+		t.Errorf("invalid logic. ids=%v", ids)
+	}
+}
+
+func TestHFTokenizerMetaspaceByteFallback(t *testing.T) {
+	filename := writeHFTokenizer(t, `{
+		"pre_tokenizer": {"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always", "split": true},
+		"model": {
+			"type": "BPE",
+			"vocab": {"▁": 0, "a": 1, "b": 2, "▁a": 3, "▁ab": 4, "<0xE4>": 5, "<0xB8>": 6, "<0x80>": 7},
+			"merges": [["▁", "a"], ["▁a", "b"]],
+			"byte_fallback": true
+		}
+	}`)
+
+	tokenizer, err := NewHFTokenizer(filename)
+	if err != nil {
+		t.Fatalf("NewHFTokenizer() error. err=[%v]", err)
+	}
+	if ids := tokenizer.Encode("ab ab 一"); !reflect.DeepEqual(ids, []int{4, 4, 0, 5, 6, 7}) {
+		t.Errorf("invalid logic. ids=%v", ids)
+	}
+}
+
+func TestHFTokenizerUnsupported(t *testing.T) {
+	filename := writeHFTokenizer(t, `{"model": {"type": "WordPiece", "vocab": {}}}`)
+	if _, err := NewHFTokenizer(filename); err == nil {
+		t.Errorf("invalid logic. WordPiece model should fail")
+	}
+
+	filename = writeHFTokenizer(t, `{"pre_tokenizer": {"type": "Unknown"}, "model": {"type": "BPE", "vocab": {}, "merges": []}}`)
+	if _, err := NewHFTokenizer(filename); err == nil {
+		t.Errorf("invalid logic. unknown pre-tokenizer should fail")
+	}
+}
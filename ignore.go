@@ -0,0 +1,263 @@
+package ctoc
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the name of the ctoc specific ignore file, in gitignore syntax.
+const IgnoreFileName string = ".ctocignore"
+
+// ignoreFileNames are read in each directory, the latter takes precedence.
+var ignoreFileNames = []string{".gitignore", IgnoreFileName}
+
+// ignoreRule is a pattern of an ignore file.
+type ignoreRule struct {
+	// base is the directory of the ignore file, patterns are relative to it
+	base     string
+	re       *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreMatcher matches paths of a walk against the ignore files of the walked directories,
+// their parent directories in the git repository and .git/info/exclude.
+type ignoreMatcher struct {
+	root    string
+	absRoot string
+	// top is the topmost directory with ignore rules
+	top   string
+	rules map[string][]ignoreRule
+	// open opens the ignore files, os.Open when nil
+	open func(name string) (io.ReadCloser, error)
+}
+
+func newIgnoreMatcher(root string) *ignoreMatcher {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		absRoot = root
+	}
+	m := &ignoreMatcher{
+		root:    root,
+		absRoot: absRoot,
+		top:     absRoot,
+		rules:   make(map[string][]ignoreRule),
+	}
+
+	if isGitRepository(absRoot) {
+		m.loadFile(absRoot, filepath.Join(absRoot, ".git", "info", "exclude"))
+		return m
+	}
+
+	// the ignore files of the parent directories apply up to the root of the git repository
+	var parents []string
+	for dir := filepath.Dir(absRoot); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		parents = append(parents, dir)
+		if isGitRepository(dir) {
+			m.top = dir
+			m.loadFile(dir, filepath.Join(dir, ".git", "info", "exclude"))
+			for _, parent := range parents {
+				m.loadDir(parent)
+			}
+			break
+		}
+	}
+	return m
+}
+
+// newFSIgnoreMatcher returns ignoreMatcher for a walk of root in fsys, the ignore files of
+// the parent directories of root and .git/info/exclude apply up to the root of fsys.
+func newFSIgnoreMatcher(fsys fs.FS, root string) *ignoreMatcher {
+	m := &ignoreMatcher{
+		root:    filepath.FromSlash(root),
+		absRoot: filepath.FromSlash(root),
+		top:     ".",
+		rules:   make(map[string][]ignoreRule),
+		open: func(name string) (io.ReadCloser, error) {
+			return fsys.Open(filepath.ToSlash(name))
+		},
+	}
+
+	m.loadFile(".", filepath.Join(".git", "info", "exclude"))
+	for dir := root; dir != "."; {
+		dir = path.Dir(dir)
+		m.loadDir(filepath.FromSlash(dir))
+	}
+	return m
+}
+
+func isGitRepository(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil && info.IsDir()
+}
+
+// enter reads the ignore files in the directory of the walk.
+func (m *ignoreMatcher) enter(path string) {
+	m.loadDir(m.walked(path))
+}
+
+// loadDir reads the ignore files in dir.
+func (m *ignoreMatcher) loadDir(dir string) {
+	for _, name := range ignoreFileNames {
+		m.loadFile(dir, filepath.Join(dir, name))
+	}
+}
+
+func (m *ignoreMatcher) loadFile(dir, filename string) {
+	open := m.open
+	if open == nil {
+		open = func(name string) (io.ReadCloser, error) {
+			return os.Open(name)
+		}
+	}
+	fp, err := open(filename)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(dir, scanner.Text()); ok {
+			m.rules[dir] = append(m.rules[dir], rule)
+		}
+	}
+}
+
+// walked returns the absolute path of a path of the walk.
+func (m *ignoreMatcher) walked(path string) string {
+	rel, err := filepath.Rel(m.root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.Join(m.absRoot, rel)
+}
+
+// isIgnored reports whether the path of the walk is ignored, the last matching rule wins
+// and the rules of deeper directories take precedence.
+func (m *ignoreMatcher) isIgnored(path string, isDir bool) bool {
+	path = m.walked(path)
+
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == m.top || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	ignored := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		for _, rule := range m.rules[dirs[i]] {
+			if rule.match(path, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(r.base, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if !r.anchored {
+		rel = rel[strings.LastIndex(rel, "/")+1:]
+	}
+	return r.re.MatchString(rel)
+}
+
+// parseIgnoreRule parses a line of an ignore file in gitignore syntax.
+func parseIgnoreRule(base, line string) (ignoreRule, bool) {
+	rule := ignoreRule{base: base}
+
+	if !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimRight(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+
+	re, err := regexp.Compile(ignorePatternRegexp(line))
+	if err != nil {
+		return rule, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// ignorePatternRegexp converts a gitignore glob pattern to a regular expression.
+func ignorePatternRegexp(pattern string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**") && (i == 0 || pattern[i-1] == '/') {
+				// "**/" matches zero or more directories and a trailing "**" matches everything inside
+				if i+2 == len(pattern) {
+					sb.WriteString(".*")
+					i++
+					continue
+				}
+				if pattern[i+2] == '/' {
+					sb.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
@@ -0,0 +1,115 @@
+package ctoc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIgnorePatternRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.log", "debug.log", true},
+		{"*.log", "debug.txt", false},
+		{"a/*.go", "a/b/c.go", false},
+		{"a/**/c.go", "a/c.go", true},
+		{"a/**/c.go", "a/b/d/c.go", true},
+		{"**/build", "x/y/build", true},
+		{"vendor/**", "vendor/a/b.go", true},
+		{"vendor/**", "vendor", false},
+		{"f?o.[ch]", "foo.c", true},
+		{"f?o.[!ch]", "foo.c", false},
+		{`\#keep`, "#keep", true},
+	}
+	for _, test := range tests {
+		rule, ok := parseIgnoreRule("", test.pattern)
+		if !ok {
+			t.Fatalf("invalid pattern. pattern=%v", test.pattern)
+		}
+		if match := rule.re.MatchString(test.path); match != test.match {
+			t.Errorf("invalid logic. pattern=%v path=%v match=%v", test.pattern, test.path, match)
+		}
+	}
+
+	for _, line := range []string{"", "  ", "# comment", "/"} {
+		if _, ok := parseIgnoreRule("", line); ok {
+			t.Errorf("invalid logic. line=%q is not a rule", line)
+		}
+	}
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("os.MkdirAll() error. err=[%v]", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("os.WriteFile() error. err=[%v]", err)
+		}
+	}
+}
+
+func analyzedFiles(t *testing.T, root string, opts *ClocOptions) []string {
+	t.Helper()
+	result, err := getAllFiles([]string{root}, NewDefinedLanguages(), opts)
+	if err != nil {
+		t.Fatalf("getAllFiles() error. err=[%v]", err)
+	}
+	var files []string
+	for _, lang := range result {
+		for _, file := range lang.Files {
+			rel, _ := filepath.Rel(root, file)
+			files = append(files, filepath.ToSlash(rel))
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestGetAllFilesWithIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		".git/info/exclude":         "secret.go\n",
+		".gitignore":                "node_modules/\n*.gen.go\n!keep.gen.go\n/build\n",
+		".ctocignore":               "docs/\n",
+		"main.go":                   "package main\n",
+		"secret.go":                 "package main\n",
+		"api.gen.go":                "package main\n",
+		"keep.gen.go":               "package main\n",
+		"build/out.go":              "package main\n",
+		"docs/doc.go":               "package main\n",
+		"node_modules/a/index.js":   "var a = 1\n",
+		"pkg/build/util.go":         "package build\n",
+		"pkg/.gitignore":            "*.py\n!keep.py\n",
+		"pkg/main.py":               "print(1)\n",
+		"pkg/keep.py":               "print(2)\n",
+		"pkg/sub/other.gen.go":      "package sub\n",
+		"pkg/sub/.gitignore":        "!other.gen.go\n",
+		"pkg/sub/node_modules/b.js": "var b = 2\n",
+	})
+
+	clocOpts := NewClocOptions()
+	clocOpts.SkipDuplicated = true
+	expected := []string{"keep.gen.go", "main.go", "pkg/build/util.go", "pkg/keep.py", "pkg/sub/other.gen.go"}
+	if files := analyzedFiles(t, dir, clocOpts); !reflect.DeepEqual(files, expected) {
+		t.Errorf("invalid ignored files. files=%v", files)
+	}
+
+	// the ignore files of the parent directories in the repository apply
+	expected = []string{"build/util.go", "keep.py", "sub/other.gen.go"}
+	if files := analyzedFiles(t, filepath.Join(dir, "pkg"), clocOpts); !reflect.DeepEqual(files, expected) {
+		t.Errorf("invalid ignored files in sub directory. files=%v", files)
+	}
+
+	clocOpts.NoIgnore = true
+	if files := analyzedFiles(t, dir, clocOpts); len(files) != 12 {
+		t.Errorf("invalid files with NoIgnore. files=%v", files)
+	}
+}
@@ -2,14 +2,18 @@ package ctoc
 
 // JSONLanguagesResult defines the result of the analysis in JSON format.
 type JSONLanguagesResult struct {
-	Languages []ClocLanguage `json:"languages"`
-	Total     ClocLanguage   `json:"total"`
+	Model      string         `json:"model,omitempty"`
+	Incomplete bool           `json:"incomplete,omitempty"`
+	Languages  []ClocLanguage `json:"languages"`
+	Total      ClocLanguage   `json:"total"`
 }
 
 // JSONFilesResult defines the result of the analysis(by files) in JSON format.
 type JSONFilesResult struct {
-	Files []ClocFile   `json:"files"`
-	Total ClocLanguage `json:"total"`
+	Model      string       `json:"model,omitempty"`
+	Incomplete bool         `json:"incomplete,omitempty"`
+	Files      []ClocFile   `json:"files"`
+	Total      ClocLanguage `json:"total"`
 }
 
 // NewJSONLanguagesResultFromCloc returns JSONLanguagesResult with default data set.
@@ -23,6 +27,14 @@ func NewJSONLanguagesResultFromCloc(total *Language, sortedLanguages Languages)
 			Comments:   language.Comments,
 			Blanks:     language.Blanks,
 			Tokens:     language.Tokens,
+
+			CodeTokens:    language.CodeTokens,
+			CommentTokens: language.CommentTokens,
+			BlankTokens:   language.BlankTokens,
+			TokensError:   language.TokensError,
+
+			EncodingTokens: language.EncodingTokens,
+			Costs:          language.Costs,
 		}
 		langs = append(langs, c)
 	}
@@ -32,6 +44,14 @@ func NewJSONLanguagesResultFromCloc(total *Language, sortedLanguages Languages)
 		Comments:   total.Comments,
 		Blanks:     total.Blanks,
 		Tokens:     total.Tokens,
+
+		CodeTokens:    total.CodeTokens,
+		CommentTokens: total.CommentTokens,
+		BlankTokens:   total.BlankTokens,
+		TokensError:   total.TokensError,
+
+		EncodingTokens: total.EncodingTokens,
+		Costs:          total.Costs,
 	}
 
 	return JSONLanguagesResult{
@@ -48,6 +68,14 @@ func NewJSONFilesResultFromCloc(total *Language, sortedFiles ClocFiles) JSONFile
 		Comments:   total.Comments,
 		Blanks:     total.Blanks,
 		Tokens:     total.Tokens,
+
+		CodeTokens:    total.CodeTokens,
+		CommentTokens: total.CommentTokens,
+		BlankTokens:   total.BlankTokens,
+		TokensError:   total.TokensError,
+
+		EncodingTokens: total.EncodingTokens,
+		Costs:          total.Costs,
 	}
 
 	return JSONFilesResult{
@@ -55,3 +83,22 @@ func NewJSONFilesResultFromCloc(total *Language, sortedFiles ClocFiles) JSONFile
 		Total: t,
 	}
 }
+
+// JSONDiffResult defines the result of the diff in JSON format.
+type JSONDiffResult struct {
+	Model     string    `json:"model,omitempty"`
+	Languages DiffStats `json:"languages,omitempty"`
+	Files     DiffStats `json:"files,omitempty"`
+	Total     DiffStat  `json:"total"`
+}
+
+// NewJSONDiffResult returns JSONDiffResult with the stats of each language, or of each file with byFile.
+func NewJSONDiffResult(diff *DiffResult, byFile bool) JSONDiffResult {
+	result := JSONDiffResult{Total: *diff.Total}
+	if byFile {
+		result.Files = sortedDiffStats(diff.Files)
+	} else {
+		result.Languages = sortedDiffStats(diff.Languages)
+	}
+	return result
+}
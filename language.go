@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -22,6 +21,14 @@ type ClocLanguage struct {
 	Comments   int32  `xml:"comment,attr" json:"comment"`
 	Blanks     int32  `xml:"blank,attr" json:"blank"`
 	Tokens     int32  `xml:"tokens,attr" json:"tokens"`
+
+	CodeTokens    int32 `xml:"code_tokens,attr" json:"code_tokens"`
+	CommentTokens int32 `xml:"comment_tokens,attr" json:"comment_tokens"`
+	BlankTokens   int32 `xml:"blank_tokens,attr" json:"blank_tokens"`
+	TokensError   int32 `xml:"tokens_error,attr,omitempty" json:"tokens_error,omitempty"`
+
+	EncodingTokens TokensByEncoding `xml:"-" json:"encoding_tokens,omitempty"`
+	Costs          CostByModel      `xml:"-" json:"costs,omitempty"`
 }
 
 // Language is a type used to definitions and store statistics for one programming language.
@@ -35,6 +42,18 @@ type Language struct {
 	Blanks       int32
 	Tokens       int32
 	Total        int32
+
+	CodeTokens    int32
+	CommentTokens int32
+	BlankTokens   int32
+	TokensError   int32
+
+	EncodingTokens TokensByEncoding
+	Costs          CostByModel
+
+	// BytesPerToken and TokensErrorRate calibrate Estimator for the language.
+	BytesPerToken   float64
+	TokensErrorRate float64
 }
 
 // Languages is an array representation of Language.
@@ -366,8 +385,8 @@ func getShebang(line string) (shebangLang string, ok bool) {
 	return "", false
 }
 
-func getFileTypeByShebang(path string) (shebangLang string, ok bool) {
-	f, err := os.Open(path)
+func getFileTypeByShebang(path string, opts *ClocOptions) (shebangLang string, ok bool) {
+	f, err := opts.openFile(path)
 	if err != nil {
 		return // ignore error
 	}
@@ -392,7 +411,7 @@ func getFileType(path string, opts *ClocOptions) (ext string, ok bool) {
 
 	switch ext {
 	case ".m", ".v", ".fs", ".r", ".ts":
-		content, err := os.ReadFile(path)
+		content, err := opts.readFile(path)
 		if err != nil {
 			return "", false
 		}
@@ -402,7 +421,7 @@ func getFileType(path string, opts *ClocOptions) (ext string, ok bool) {
 		}
 		return lang, true
 	case ".mo":
-		content, err := os.ReadFile(path)
+		content, err := opts.readFile(path)
 		if err != nil {
 			return "", false
 		}
@@ -440,7 +459,7 @@ func getFileType(path string, opts *ClocOptions) (ext string, ok bool) {
 		return "", false
 	}
 
-	shebangLang, ok := getFileTypeByShebang(path)
+	shebangLang, ok := getFileTypeByShebang(path, opts)
 	if ok {
 		return shebangLang, true
 	}
@@ -453,11 +472,17 @@ func getFileType(path string, opts *ClocOptions) (ext string, ok bool) {
 
 // NewLanguage create language data store.
 func NewLanguage(name string, lineComments []string, multiLines [][]string) *Language {
+	estimate, ok := languageEstimates[name]
+	if !ok {
+		estimate = [2]float64{defaultBytesPerToken, defaultTokensErrorRate}
+	}
 	return &Language{
-		Name:         name,
-		lineComments: lineComments,
-		multiLines:   multiLines,
-		Files:        []string{},
+		Name:            name,
+		lineComments:    lineComments,
+		multiLines:      multiLines,
+		Files:           []string{},
+		BytesPerToken:   estimate[0],
+		TokensErrorRate: estimate[1],
 	}
 }
 
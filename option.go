@@ -1,9 +1,10 @@
 package ctoc
 
 import (
+	"context"
+	"io"
+	"os"
 	"regexp"
-
-	"github.com/pkoukk/tiktoken-go"
 )
 
 // ClocOptions is gocloc processor options.
@@ -16,7 +17,31 @@ type ClocOptions struct {
 	ReMatch        *regexp.Regexp
 	ReNotMatchDir  *regexp.Regexp
 	ReMatchDir     *regexp.Regexp
-	Tokenizer      *tiktoken.Tiktoken
+	Tokenizer      Tokenizer
+	// Tokenizers are counted side by side with Tokenizer. When set, the counts
+	// of Tokenizer and Tokenizers are stored in EncodingTokens keyed by Name().
+	Tokenizers []Tokenizer
+	// Jobs is the number of files analyzed concurrently, files are analyzed
+	// sequentially when it is less than 2. The Tokenizer and the On* callbacks
+	// must be safe for concurrent use when Jobs is greater than 1.
+	Jobs int
+	// WholeFile tokenizes the whole file content at once instead of line by
+	// line, so newlines and merges across lines are counted as the model sees them.
+	// The code, comment and blank token counts are still counted line by line.
+	WholeFile bool
+	// NoIgnore disables the .gitignore, .git/info/exclude and .ctocignore
+	// files, which exclude files from the analysis in gitignore syntax.
+	NoIgnore bool
+	// VCS lists the files to analyze from a version control system instead of
+	// walking the directories, only "git" is supported: the files of the git
+	// index, or of the tree of Revision when it is set.
+	VCS string
+	// Revision is a git revision or tree-ish (e.g. HEAD~10, v1.0, HEAD:src) to
+	// analyze the files of without checking them out.
+	Revision string
+	// Cache stores the results of analyzed files between runs, files are always
+	// analyzed when it is nil. The cache is not used when the On* callbacks or Debug are set.
+	Cache *Cache
 
 	// OnCode is triggered for each line of code.
 	OnCode func(line string)
@@ -24,16 +49,65 @@ type ClocOptions struct {
 	OnBlank func(line string)
 	// OnComment is triggered for each line of comments.
 	OnComment func(line string)
+
+	// open opens the files to analyze, os.Open is used when it is nil.
+	open func(name string) (io.ReadCloser, error)
+	// ctx interrupts the analysis, it never ends when it is nil.
+	ctx context.Context
+	// archives is the analyzed archives whose files are opened by reading the archive again.
+	archives map[string]struct{}
+	// archived is the results of the files in archives, which are analyzed while the archives are read.
+	archived map[string]*ClocFile
+	// onLine is triggered for each line with its kind and token count.
+	onLine func(line string, kind lineKind, tokens int32)
+}
+
+// lineKind is the kind of a line of a file.
+type lineKind int8
+
+const (
+	lineBlank lineKind = iota
+	lineComment
+	lineCode
+)
+
+func (opts *ClocOptions) context() context.Context {
+	if opts.ctx == nil {
+		return context.Background()
+	}
+	return opts.ctx
+}
+
+func (opts *ClocOptions) openFile(name string) (io.ReadCloser, error) {
+	if opts.open != nil {
+		return opts.open(name)
+	}
+	return os.Open(name)
+}
+
+func (opts *ClocOptions) readFile(name string) ([]byte, error) {
+	if opts.open == nil {
+		return os.ReadFile(name)
+	}
+	fp, err := opts.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return io.ReadAll(fp)
 }
 
 // NewClocOptions create new ClocOptions with default values.
 func NewClocOptions() *ClocOptions {
-	tke, _ := tiktoken.GetEncoding("cl100k_base")
-	return &ClocOptions{
+	opts := &ClocOptions{
 		Debug:          false,
 		SkipDuplicated: false,
 		ExcludeExts:    make(map[string]struct{}),
 		IncludeLangs:   make(map[string]struct{}),
-		Tokenizer:      tke,
+		Jobs:           1,
+	}
+	if tke, err := NewTiktokenTokenizer(DefaultEncoding); err == nil {
+		opts.Tokenizer = tke
 	}
+	return opts
 }
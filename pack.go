@@ -0,0 +1,151 @@
+package ctoc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PackStrategy is the order in which Pack picks the files fitting the budget.
+type PackStrategy string
+
+const (
+	// PackBySize picks the smallest files first, to pack as many files as possible
+	PackBySize PackStrategy = "size"
+	// PackByPriority picks the files matching the earlier priority patterns first, then the other files by path
+	PackByPriority PackStrategy = "priority"
+	// PackByRecency picks the most recently modified files first
+	PackByRecency PackStrategy = "recency"
+)
+
+// PackOptions is the options of Pack.
+type PackOptions struct {
+	// Budget is the maximum number of tokens of the picked files.
+	Budget int32
+	// Strategy is the order in which the files are picked, PackBySize when it is empty.
+	Strategy PackStrategy
+	// Priority is the list of patterns of PackByPriority, a pattern matches a file by its path,
+	// the name of the file (e.g. *.go) or a parent directory (e.g. cmd/ctoc).
+	Priority []string
+	// Roots are the analyzed paths, the patterns also match the paths of the files relative to them.
+	Roots []string
+	// ModTime returns the modification time of a file for PackByRecency, os.Stat is used when it is nil.
+	ModTime func(name string) (time.Time, error)
+}
+
+// PackResult is the files picked by Pack to fit the budget.
+type PackResult struct {
+	XMLName  xml.Name  `xml:"pack" json:"-"`
+	Budget   int32     `xml:"budget,attr" json:"budget"`
+	Tokens   int32     `xml:"tokens,attr" json:"tokens"`
+	Headroom int32     `xml:"headroom,attr" json:"headroom"`
+	Included ClocFiles `xml:"included>file" json:"included"`
+	Excluded ClocFiles `xml:"excluded>file" json:"excluded"`
+}
+
+// Pack picks the files of result fitting within the token budget, in the order of the strategy.
+// A file which does not fit is excluded and the next files are still tried.
+func Pack(result *Result, opts PackOptions) (*PackResult, error) {
+	if opts.Budget <= 0 {
+		return nil, fmt.Errorf("invalid budget: %d", opts.Budget)
+	}
+
+	files := make(ClocFiles, 0, len(result.Files))
+	for _, file := range result.Files {
+		files = append(files, *file)
+	}
+	files.SortByName()
+
+	switch opts.Strategy {
+	case PackBySize, "":
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].Tokens < files[j].Tokens
+		})
+	case PackByPriority:
+		ranks := make(map[string]int, len(files))
+		for _, file := range files {
+			ranks[file.Name] = priorityRank(file.Name, opts.Roots, opts.Priority)
+		}
+		sort.SliceStable(files, func(i, j int) bool {
+			return ranks[files[i].Name] < ranks[files[j].Name]
+		})
+	case PackByRecency:
+		modTime := opts.ModTime
+		if modTime == nil {
+			modTime = func(name string) (time.Time, error) {
+				info, err := os.Stat(name)
+				if err != nil {
+					return time.Time{}, err
+				}
+				return info.ModTime(), nil
+			}
+		}
+		// files without a modification time (e.g. in a revision or an archive) are the oldest
+		modTimes := make(map[string]time.Time, len(files))
+		for _, file := range files {
+			modTimes[file.Name], _ = modTime(file.Name)
+		}
+		sort.SliceStable(files, func(i, j int) bool {
+			return modTimes[files[i].Name].After(modTimes[files[j].Name])
+		})
+	default:
+		return nil, fmt.Errorf("unknown pack strategy: %s", opts.Strategy)
+	}
+
+	pack := &PackResult{Budget: opts.Budget, Included: ClocFiles{}, Excluded: ClocFiles{}}
+	for _, file := range files {
+		if pack.Tokens+file.Tokens <= opts.Budget {
+			pack.Tokens += file.Tokens
+			pack.Included = append(pack.Included, file)
+		} else {
+			pack.Excluded = append(pack.Excluded, file)
+		}
+	}
+	pack.Headroom = opts.Budget - pack.Tokens
+	return pack, nil
+}
+
+// priorityRank returns the index of the first pattern matching the file by its path as given or
+// relative to the root containing it, or the number of patterns.
+func priorityRank(name string, roots []string, patterns []string) int {
+	names := []string{filepath.ToSlash(filepath.Clean(name))}
+	if rel, ok := relativeToRoots(name, roots); ok {
+		names = append(names, rel)
+	}
+	for i, pattern := range patterns {
+		pattern = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(pattern)), "/")
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return i
+			}
+			if ok, _ := path.Match(pattern, path.Base(name)); ok {
+				return i
+			}
+			if strings.HasPrefix(name, pattern+"/") {
+				return i
+			}
+		}
+	}
+	return len(patterns)
+}
+
+// relativeToRoots returns the slash-separated path of the file relative to the first root containing it,
+// the path in the archive for a file in an archive root.
+func relativeToRoots(name string, roots []string) (string, bool) {
+	for _, root := range roots {
+		if strings.HasPrefix(name, root+ArchiveSeparator) {
+			return strings.TrimPrefix(name, root+ArchiveSeparator), true
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return filepath.ToSlash(rel), true
+	}
+	return "", false
+}
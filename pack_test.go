@@ -0,0 +1,92 @@
+package ctoc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func packedFiles(files ClocFiles) []string {
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+func TestPack(t *testing.T) {
+	result := &Result{Files: map[string]*ClocFile{
+		"main.go":            {Name: "main.go", Tokens: 40},
+		"cmd/ctoc/main.go":   {Name: "cmd/ctoc/main.go", Tokens: 50},
+		"util.go":            {Name: "util.go", Tokens: 10},
+		"util_test.go":       {Name: "util_test.go", Tokens: 30},
+		"docs/README.md":     {Name: "docs/README.md", Tokens: 20},
+		"./docs/examples.md": {Name: "./docs/examples.md", Tokens: 100},
+	}}
+
+	tests := []struct {
+		opts     PackOptions
+		included []string
+		excluded []string
+	}{
+		{
+			PackOptions{Budget: 100},
+			[]string{"util.go", "docs/README.md", "util_test.go", "main.go"},
+			[]string{"cmd/ctoc/main.go", "./docs/examples.md"},
+		},
+		{
+			PackOptions{Budget: 100, Strategy: PackByPriority, Priority: []string{"cmd/ctoc", "*.md", "util.go"}},
+			[]string{"cmd/ctoc/main.go", "docs/README.md", "util.go"},
+			[]string{"./docs/examples.md", "main.go", "util_test.go"},
+		},
+		{
+			PackOptions{Budget: 100, Strategy: PackByPriority, Priority: []string{"./docs/"}},
+			[]string{"./docs/examples.md"},
+			[]string{"docs/README.md", "cmd/ctoc/main.go", "main.go", "util.go", "util_test.go"},
+		},
+		{
+			PackOptions{Budget: 100, Strategy: PackByRecency, ModTime: func(name string) (time.Time, error) {
+				times := map[string]int64{"main.go": 3, "util_test.go": 2, "cmd/ctoc/main.go": 1}
+				return time.Unix(times[name], 0), nil
+			}},
+			[]string{"main.go", "util_test.go", "docs/README.md", "util.go"},
+			[]string{"cmd/ctoc/main.go", "./docs/examples.md"},
+		},
+	}
+	for _, test := range tests {
+		pack, err := Pack(result, test.opts)
+		if err != nil {
+			t.Fatalf("Pack() error. err=[%v]", err)
+		}
+		if included := packedFiles(pack.Included); !reflect.DeepEqual(included, test.included) {
+			t.Errorf("invalid included files. strategy=%v included=%v", test.opts.Strategy, included)
+		}
+		if excluded := packedFiles(pack.Excluded); !reflect.DeepEqual(excluded, test.excluded) {
+			t.Errorf("invalid excluded files. strategy=%v excluded=%v", test.opts.Strategy, excluded)
+		}
+		if pack.Tokens > pack.Budget || pack.Tokens+pack.Headroom != pack.Budget {
+			t.Errorf("invalid logic. pack=%+v", pack)
+		}
+	}
+
+	// the patterns match the paths relative to the roots
+	rooted := &Result{Files: map[string]*ClocFile{
+		"/src/app/main.go":          {Name: "/src/app/main.go", Tokens: 40},
+		"/src/app/cmd/ctoc/main.go": {Name: "/src/app/cmd/ctoc/main.go", Tokens: 50},
+		"src.tgz!/cmd/ctoc/util.go": {Name: "src.tgz!/cmd/ctoc/util.go", Tokens: 10},
+	}}
+	pack, err := Pack(rooted, PackOptions{Budget: 60, Strategy: PackByPriority, Priority: []string{"cmd/ctoc"}, Roots: []string{"/src/app", "src.tgz"}})
+	if err != nil {
+		t.Fatalf("Pack() error. err=[%v]", err)
+	}
+	if included := packedFiles(pack.Included); !reflect.DeepEqual(included, []string{"/src/app/cmd/ctoc/main.go", "src.tgz!/cmd/ctoc/util.go"}) {
+		t.Errorf("invalid included files. included=%v", included)
+	}
+
+	if _, err := Pack(result, PackOptions{Budget: 0}); err == nil {
+		t.Errorf("invalid logic. expected error for invalid budget")
+	}
+	if _, err := Pack(result, PackOptions{Budget: 100, Strategy: "random"}); err == nil {
+		t.Errorf("invalid logic. expected error for unknown strategy")
+	}
+}
@@ -0,0 +1,537 @@
+package ctoc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// SentencePiece model types of TrainerSpec.model_type.
+const (
+	spmModelUnigram = 1
+	spmModelBPE     = 2
+)
+
+// SentencePiece piece types of ModelProto.SentencePiece.type.
+const (
+	spmPieceNormal      = 1
+	spmPieceUnknown     = 2
+	spmPieceControl     = 3
+	spmPieceUserDefined = 4
+	spmPieceUnused      = 5
+	spmPieceByte        = 6
+)
+
+// spmUnkPenalty is subtracted from the lowest piece score to score unknown characters.
+const spmUnkPenalty = 10.0
+
+// spmWhitespace is the meta symbol replacing whitespaces.
+const spmWhitespace = "▁"
+
+// SentencePieceTokenizer is a Tokenizer for SentencePiece unigram and BPE .model files.
+//
+// The text is normalized by the precompiled character map of the model as SentencePiece does (e.g. nmt_nfkc),
+// the user-defined pieces are kept as they are.
+type SentencePieceTokenizer struct {
+	name                   string
+	digest                 string
+	modelType              int
+	pieces                 map[string]int
+	scores                 []float32
+	types                  []int
+	maxPieceLen            int
+	maxUserDefinedLen      int
+	unkID                  int
+	unkScore               float64
+	maxScore               float64
+	byteFallback           bool
+	charsMap               *spmCharsMap
+	addDummyPrefix         bool
+	removeExtraWhitespaces bool
+	escapeWhitespaces      bool
+}
+
+// NewSentencePieceTokenizer returns SentencePieceTokenizer for a SentencePiece .model file.
+// The tokenizer is named after its directory when the file is named tokenizer.model.
+func NewSentencePieceTokenizer(filename string) (*SentencePieceTokenizer, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseSentencePieceModel(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	t.name = tokenizerNameFromFile(filename)
+	t.digest = contentDigest(content)
+	return t, nil
+}
+
+func parseSentencePieceModel(content []byte) (*SentencePieceTokenizer, error) {
+	t := &SentencePieceTokenizer{
+		modelType:              spmModelUnigram,
+		pieces:                 make(map[string]int),
+		unkID:                  -1,
+		addDummyPrefix:         true,
+		removeExtraWhitespaces: true,
+		escapeWhitespaces:      true,
+	}
+
+	minScore, maxScore := float32(math.MaxFloat32), float32(-math.MaxFloat32)
+	err := protoFields(content, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1: // pieces
+			piece, score, pieceType := "", float32(0), spmPieceNormal
+			err := protoFields(data, func(num int, v uint64, data []byte) error {
+				switch num {
+				case 1:
+					piece = string(data)
+				case 2:
+					score = math.Float32frombits(uint32(v))
+				case 3:
+					pieceType = int(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			id := len(t.scores)
+			t.scores = append(t.scores, score)
+			t.types = append(t.types, pieceType)
+			switch pieceType {
+			case spmPieceUnknown:
+				t.unkID = id
+			case spmPieceNormal, spmPieceUserDefined, spmPieceByte:
+				t.pieces[piece] = id
+				if pieceType != spmPieceByte {
+					n := len([]rune(piece))
+					if n > t.maxPieceLen {
+						t.maxPieceLen = n
+					}
+					if pieceType == spmPieceUserDefined && n > t.maxUserDefinedLen {
+						t.maxUserDefinedLen = n
+					}
+					if pieceType == spmPieceNormal && score < minScore {
+						minScore = score
+					}
+					if pieceType == spmPieceNormal && score > maxScore {
+						maxScore = score
+					}
+				}
+			}
+		case 2: // trainer_spec
+			return protoFields(data, func(num int, v uint64, data []byte) error {
+				switch num {
+				case 3:
+					t.modelType = int(v)
+				case 35:
+					t.byteFallback = v != 0
+				}
+				return nil
+			})
+		case 3: // normalizer_spec
+			return protoFields(data, func(num int, v uint64, data []byte) error {
+				switch num {
+				case 2:
+					charsMap, err := parseSPMCharsMap(data)
+					if err != nil {
+						return err
+					}
+					t.charsMap = charsMap
+				case 3:
+					t.addDummyPrefix = v != 0
+				case 4:
+					t.removeExtraWhitespaces = v != 0
+				case 5:
+					t.escapeWhitespaces = v != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(t.scores) == 0 {
+		return nil, errors.New("no pieces in sentencepiece model")
+	}
+	if t.unkID < 0 {
+		return nil, errors.New("no unknown piece in sentencepiece model")
+	}
+	if t.modelType != spmModelUnigram && t.modelType != spmModelBPE {
+		return nil, fmt.Errorf("unsupported sentencepiece model type: %d", t.modelType)
+	}
+	t.unkScore = float64(minScore) - spmUnkPenalty
+	t.maxScore = float64(maxScore)
+	if minScore > maxScore {
+		// no normal pieces
+		t.unkScore, t.maxScore = -spmUnkPenalty, 0
+	}
+	return t, nil
+}
+
+// protoFields calls fn for each field of a protobuf message, v is the value of
+// varint and fixed fields and data is the content of length-delimited fields.
+func protoFields(b []byte, fn func(num int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("invalid protobuf field")
+		}
+		b = b[n:]
+
+		var v uint64
+		var data []byte
+		switch key & 7 {
+		case 0:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errors.New("invalid protobuf varint")
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return errors.New("invalid protobuf fixed64")
+			}
+			v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errors.New("invalid protobuf length")
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return errors.New("invalid protobuf fixed32")
+			}
+			v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type: %d", key&7)
+		}
+
+		if err := fn(int(key>>3), v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode returns the token ids for text.
+func (t *SentencePieceTokenizer) Encode(text string) []int {
+	text = t.normalize(text)
+	if text == "" {
+		return nil
+	}
+	if t.modelType == spmModelBPE {
+		return t.encodeBPE(text)
+	}
+	return t.encodeUnigram(text)
+}
+
+// Count returns the number of tokens for text.
+func (t *SentencePieceTokenizer) Count(text string) int {
+	return len(t.Encode(text))
+}
+
+// Name returns the tokenizer name.
+func (t *SentencePieceTokenizer) Name() string {
+	return t.name
+}
+
+func (t *SentencePieceTokenizer) definitionDigest() string {
+	return t.digest
+}
+
+// normalize returns the text normalized as the Normalizer of SentencePiece, with the whitespaces escaped.
+func (t *SentencePieceTokenizer) normalize(text string) string {
+	space := " "
+	if t.escapeWhitespaces {
+		space = spmWhitespace
+	}
+
+	// the leading whitespaces are removed
+	if t.removeExtraWhitespaces {
+		for text != "" {
+			piece, n := t.normalizePrefix(text)
+			if piece != " " {
+				break
+			}
+			text = text[n:]
+		}
+	}
+	if text == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+	if t.addDummyPrefix {
+		sb.WriteString(space)
+	}
+	prevSpace := t.removeExtraWhitespaces
+	for text != "" {
+		piece, n := t.normalizePrefix(text)
+		text = text[n:]
+		if prevSpace {
+			piece = strings.TrimLeft(piece, " ")
+		}
+		if piece != "" {
+			sb.WriteString(strings.ReplaceAll(piece, " ", space))
+			prevSpace = t.removeExtraWhitespaces && strings.HasSuffix(piece, " ")
+		}
+	}
+
+	normalized := sb.String()
+	if t.removeExtraWhitespaces {
+		for strings.HasSuffix(normalized, space) {
+			normalized = strings.TrimSuffix(normalized, space)
+		}
+	}
+	return normalized
+}
+
+// normalizePrefix returns the normalized form of the user-defined piece or the longest prefix in the character map
+// at the start of text, or its first character, and the number of bytes of text it replaces.
+func (t *SentencePieceTokenizer) normalizePrefix(text string) (string, int) {
+	if l := t.userDefinedPrefix([]rune(truncateRunes(text, t.maxUserDefinedLen))); l > 0 {
+		n := len(truncateRunes(text, l))
+		return text[:n], n
+	}
+	if t.charsMap != nil {
+		if normalized, n, ok := t.charsMap.longestPrefix(text); ok {
+			return normalized, n
+		}
+	}
+	r, n := utf8.DecodeRuneInString(text)
+	if r == utf8.RuneError && n <= 1 {
+		return "\uFFFD", 1
+	}
+	return text[:n], n
+}
+
+// truncateRunes returns the first n runes of text at most.
+func truncateRunes(text string, n int) string {
+	for i := range text {
+		if n == 0 {
+			return text[:i]
+		}
+		n--
+	}
+	return text
+}
+
+// spmCharsMap is the precompiled character map of a SentencePiece normalizer, which is a darts-clone double array
+// of the source strings whose values are the offsets of the null-terminated normalized strings.
+type spmCharsMap struct {
+	units      []uint32
+	normalized []byte
+}
+
+// parseSPMCharsMap parses the precompiled character map, the size of the double array
+// in 4 little-endian bytes, the double array and the normalized strings.
+func parseSPMCharsMap(data []byte) (*spmCharsMap, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if len(data) < 4 {
+		return nil, errors.New("invalid sentencepiece character map")
+	}
+	size := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	if size%4 != 0 || uint64(size) > uint64(len(data)) {
+		return nil, errors.New("invalid sentencepiece character map")
+	}
+	m := &spmCharsMap{units: make([]uint32, size/4), normalized: data[size:]}
+	for i := range m.units {
+		m.units[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+	return m, nil
+}
+
+// longestPrefix returns the normalized string of the longest source string at the start of text and its length.
+func (m *spmCharsMap) longestPrefix(text string) (string, int, bool) {
+	offset := func(unit uint32) uint32 {
+		return (unit >> 10) << ((unit & (1 << 9)) >> 6)
+	}
+	if len(m.units) == 0 {
+		return "", 0, false
+	}
+
+	value, length := -1, 0
+	pos := offset(m.units[0])
+	for i := 0; i < len(text); i++ {
+		pos ^= uint32(text[i])
+		if pos >= uint32(len(m.units)) {
+			break
+		}
+		unit := m.units[pos]
+		if unit&(1<<31|0xFF) != uint32(text[i]) {
+			break
+		}
+		pos ^= offset(unit)
+		if unit&(1<<8) != 0 && pos < uint32(len(m.units)) {
+			value, length = int(m.units[pos]&(1<<31-1)), i+1
+		}
+	}
+	if value < 0 || value >= len(m.normalized) {
+		return "", 0, false
+	}
+	normalized := m.normalized[value:]
+	if end := bytes.IndexByte(normalized, 0); end >= 0 {
+		normalized = normalized[:end]
+	}
+	return string(normalized), length, true
+}
+
+// encodeUnigram returns the pieces of the best segmentation by the Viterbi algorithm.
+func (t *SentencePieceTokenizer) encodeUnigram(text string) []int {
+	runes := []rune(text)
+	n := len(runes)
+	type node struct {
+		score float64
+		start int
+		id    int
+		ok    bool
+	}
+	best := make([]node, n+1)
+	best[0].ok = true
+
+	for i := 0; i < n; i++ {
+		if !best[i].ok {
+			continue
+		}
+		hasSingle := false
+		for l := 1; l <= t.maxPieceLen && i+l <= n; l++ {
+			id, ok := t.pieces[string(runes[i:i+l])]
+			if !ok || t.isByte(id) {
+				continue
+			}
+			if l == 1 {
+				hasSingle = true
+			}
+			score := best[i].score + float64(t.scores[id])
+			if t.types[id] == spmPieceUserDefined {
+				// user-defined pieces are preferred to any segmentation of them
+				score = best[i].score + float64(l)*t.maxScore - 0.1
+			}
+			if !best[i+l].ok || score > best[i+l].score {
+				best[i+l] = node{score: score, start: i, id: id, ok: true}
+			}
+		}
+		if !hasSingle {
+			score := best[i].score + t.unkScore
+			if !best[i+1].ok || score > best[i+1].score {
+				best[i+1] = node{score: score, start: i, id: t.unkID, ok: true}
+			}
+		}
+	}
+
+	var segments [][2]int
+	for i := n; i > 0; i = best[i].start {
+		segments = append(segments, [2]int{best[i].start, i})
+	}
+	ids := make([]int, 0, len(segments))
+	for k := len(segments) - 1; k >= 0; k-- {
+		s := segments[k]
+		ids = t.appendPiece(ids, string(runes[s[0]:s[1]]), best[s[1]].id)
+	}
+	return ids
+}
+
+// encodeBPE merges the adjacent pieces with the highest score until no merge is possible,
+// the user-defined pieces in text are kept as they are.
+func (t *SentencePieceTokenizer) encodeBPE(text string) []int {
+	var symbols []string
+	var frozen []bool
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		l := t.userDefinedPrefix(runes[i:])
+		frozen = append(frozen, l > 0)
+		if l == 0 {
+			l = 1
+		}
+		symbols = append(symbols, string(runes[i:i+l]))
+		i += l
+	}
+	for len(symbols) > 1 {
+		best, bestScore := -1, float32(0)
+		for i := 0; i < len(symbols)-1; i++ {
+			if frozen[i] || frozen[i+1] {
+				continue
+			}
+			id, ok := t.pieces[symbols[i]+symbols[i+1]]
+			if !ok || t.isByte(id) {
+				continue
+			}
+			if best < 0 || t.scores[id] > bestScore {
+				best, bestScore = i, t.scores[id]
+			}
+		}
+		if best < 0 {
+			break
+		}
+		symbols[best] += symbols[best+1]
+		symbols = append(symbols[:best+1], symbols[best+2:]...)
+		frozen = append(frozen[:best+1], frozen[best+2:]...)
+	}
+
+	ids := make([]int, 0, len(symbols))
+	for _, symbol := range symbols {
+		id, ok := t.pieces[symbol]
+		if !ok || t.isByte(id) {
+			id = t.unkID
+		}
+		ids = t.appendPiece(ids, symbol, id)
+	}
+	return ids
+}
+
+// userDefinedPrefix returns the length of the longest user-defined piece at the start of runes, or 0.
+func (t *SentencePieceTokenizer) userDefinedPrefix(runes []rune) int {
+	for l := t.maxUserDefinedLen; l > 0; l-- {
+		if l <= len(runes) && t.isUserDefined(string(runes[:l])) {
+			return l
+		}
+	}
+	return 0
+}
+
+// isUserDefined reports whether the piece is a user-defined piece.
+func (t *SentencePieceTokenizer) isUserDefined(piece string) bool {
+	id, ok := t.pieces[piece]
+	return ok && t.types[id] == spmPieceUserDefined
+}
+
+// appendPiece appends the piece id, unknown pieces are split into bytes with byte fallback
+// and consecutive unknown pieces are merged otherwise.
+func (t *SentencePieceTokenizer) appendPiece(ids []int, piece string, id int) []int {
+	if id != t.unkID {
+		return append(ids, id)
+	}
+	if t.byteFallback {
+		for _, b := range []byte(piece) {
+			if byteID, ok := t.pieces[fmt.Sprintf("<0x%02X>", b)]; ok {
+				ids = append(ids, byteID)
+			} else {
+				ids = append(ids, t.unkID)
+			}
+		}
+		return ids
+	}
+	if len(ids) > 0 && ids[len(ids)-1] == t.unkID {
+		return ids
+	}
+	return append(ids, t.unkID)
+}
+
+// isByte reports whether the piece is a byte piece, which is only used for byte fallback.
+func (t *SentencePieceTokenizer) isByte(id int) bool {
+	return t.types[id] == spmPieceByte
+}
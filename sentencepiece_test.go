@@ -0,0 +1,328 @@
+package ctoc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type testSentencePiece struct {
+	piece     string
+	score     float32
+	pieceType int
+}
+
+var testSentencePieces = []testSentencePiece{
+	{"<unk>", 0, spmPieceUnknown},
+	{"<s>", 0, spmPieceControl},
+	{"</s>", 0, spmPieceControl},
+	{"▁", -2, spmPieceNormal},
+	{"▁he", -3, spmPieceNormal},
+	{"llo", -3, spmPieceNormal},
+	{"▁hello", -4, spmPieceNormal},
+	{"h", -5, spmPieceNormal},
+	{"e", -5, spmPieceNormal},
+	{"l", -5, spmPieceNormal},
+	{"o", -5, spmPieceNormal},
+	{"▁w", -3, spmPieceNormal},
+	{"orld", -3, spmPieceNormal},
+	{"▁world", -4, spmPieceNormal},
+	{"<0x21>", 0, spmPieceByte},
+}
+
+func appendProtoVarint(b []byte, num int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoBytes(b []byte, num int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendProtoFloat(b []byte, num int, f float32) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|5)
+	return binary.LittleEndian.AppendUint32(b, math.Float32bits(f))
+}
+
+// writeSentencePieceModel writes a ModelProto with pieces, trainer_spec and normalizer_spec.
+func writeSentencePieceModel(t *testing.T, name string, pieces []testSentencePiece, trainerSpec, normalizerSpec []byte) string {
+	t.Helper()
+	var model []byte
+	for _, p := range pieces {
+		var piece []byte
+		piece = appendProtoBytes(piece, 1, []byte(p.piece))
+		piece = appendProtoFloat(piece, 2, p.score)
+		piece = appendProtoVarint(piece, 3, uint64(p.pieceType))
+		model = appendProtoBytes(model, 1, piece)
+	}
+	model = appendProtoBytes(model, 2, trainerSpec)
+	model = appendProtoBytes(model, 3, normalizerSpec)
+
+	dir := filepath.Join(t.TempDir(), "test-model")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("os.Mkdir() error. err=[%v]", err)
+	}
+	filename := filepath.Join(dir, name)
+	if err := os.WriteFile(filename, model, 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error. err=[%v]", err)
+	}
+	return filename
+}
+
+func TestSentencePieceTokenizerUnigram(t *testing.T) {
+	trainerSpec := appendProtoVarint(nil, 3, spmModelUnigram)
+	filename := writeSentencePieceModel(t, "tokenizer.model", testSentencePieces, trainerSpec, nil)
+
+	tokenizer, err := NewSentencePieceTokenizer(filename)
+	if err != nil {
+		t.Fatalf("NewSentencePieceTokenizer() error. err=[%v]", err)
+	}
+	if tokenizer.Name() != "test-model" {
+		t.Errorf("invalid name. name=%v", tokenizer.Name())
+	}
+	if ids := tokenizer.Encode("hello world"); !reflect.DeepEqual(ids, []int{6, 13}) {
+		t.Errorf("invalid logic. ids=%v", ids)
+	}
+	// extra whitespaces are removed
+	if ids := tokenizer.Encode("  hello   world "); !reflect.DeepEqual(ids, []int{6, 13}) {
+		t.Errorf("invalid logic. ids=%v", ids)
+	}
+	// consecutive unknown characters are merged, byte pieces are not matched
+	if ids := tokenizer.Encode("hel!!<0x21>"); !reflect.DeepEqual(ids, []int{4, 9, 0}) {
+		t.Errorf("invalid logic. ids=%v", ids)
+	}
+	if n := tokenizer.Count("   "); n != 0 {
+		t.Errorf("invalid logic. tokens=%v", n)
+	}
+}
+
+func TestSentencePieceTokenizerByteFallback(t *testing.T) {
+	trainerSpec := appendProtoVarint(nil, 3, spmModelUnigram)
+	trainerSpec = appendProtoVarint(trainerSpec, 35, 1)
+	normalizerSpec := appendProtoVarint(nil, 3, 0)
+	normalizerSpec = appendProtoVarint(normalizerSpec, 4, 0)
+	filename := writeSentencePieceModel(t, "llama.model", testSentencePieces, trainerSpec, normalizerSpec)
+
+	tokenizer, err := NewSentencePieceTokenizer(filename)
+	if err != nil {
+		t.Fatalf("NewSentencePieceTokenizer() error. err=[%v]", err)
+	}
+	if tokenizer.Name() != "llama" {
+		t.Errorf("invalid name. name=%v", tokenizer.Name())
+	}
+	// no dummy prefix and whitespaces are kept, "!" falls back to <0x21>, "?" has no byte piece
+	if ids := tokenizer.Encode("hello  world!?"); !reflect.DeepEqual(ids, []int{7, 8, 5, 3, 13, 14, 0}) {
+		t.Errorf("invalid logic. ids=%v", ids)
+	}
+}
+
+func TestSentencePieceTokenizerBPE(t *testing.T) {
+	pieces := []testSentencePiece{
+		{"<unk>", 0, spmPieceUnknown},
+		{"▁a", -1, spmPieceNormal},
+		{"ab", -0.5, spmPieceNormal},
+		{"bc", -3, spmPieceNormal},
+		{"▁ab", -2, spmPieceNormal},
+		{"▁", -10, spmPieceNormal},
+		{"a", -10, spmPieceNormal},
+		{"b", -10, spmPieceNormal},
+		{"c", -10, spmPieceNormal},
+	}
+	trainerSpec := appendProtoVarint(nil, 3, spmModelBPE)
+	filename := writeSentencePieceModel(t, "bpe.model", pieces, trainerSpec, nil)
+
+	tokenizer, err := NewSentencePieceTokenizer(filename)
+	if err != nil {
+		t.Fatalf("NewSentencePieceTokenizer() error. err=[%v]", err)
+	}
+	// "ab" is merged before "▁a", then "▁" + "ab"
+	if ids := tokenizer.Encode("abc"); !reflect.DeepEqual(ids, []int{4, 8}) {
+		t.Errorf("invalid logic. ids=%v", ids)
+	}
+	if ids := tokenizer.Encode("abc bcd"); !reflect.DeepEqual(ids, []int{4, 8, 5, 3, 0}) {
+		t.Errorf("invalid logic. ids=%v", ids)
+	}
+}
+
+func TestSentencePieceTokenizerInvalid(t *testing.T) {
+	if _, err := parseSentencePieceModel([]byte("{}")); err == nil {
+		t.Errorf("invalid logic. expected error for invalid model")
+	}
+
+	trainerSpec := appendProtoVarint(nil, 3, 3)
+	filename := writeSentencePieceModel(t, "word.model", testSentencePieces, trainerSpec, nil)
+	if _, err := NewSentencePieceTokenizer(filename); err == nil {
+		t.Errorf("invalid logic. expected error for unsupported model type")
+	}
+}
+
+// buildSPMCharsMap returns a precompiled character map of the rules, which is a darts-clone double array
+// with a block of 256 units for each node of the trie, followed by the NUL-terminated normalized strings.
+func buildSPMCharsMap(rules map[string]string) []byte {
+	type node struct {
+		children map[byte]*node
+		value    int
+	}
+	newNode := func() *node {
+		return &node{children: make(map[byte]*node), value: -1}
+	}
+	root := newNode()
+	var normalized []byte
+	for src, dst := range rules {
+		n := root
+		for i := 0; i < len(src); i++ {
+			child, ok := n.children[src[i]]
+			if !ok {
+				child = newNode()
+				n.children[src[i]] = child
+			}
+			n = child
+		}
+		n.value = len(normalized)
+		normalized = append(append(normalized, dst...), 0)
+	}
+
+	units := make([]uint32, 256)
+	var place func(n *node, pos uint32)
+	place = func(n *node, pos uint32) {
+		block := uint32(len(units))
+		units = append(units, make([]uint32, 256)...)
+		units[pos] |= (pos ^ block) << 10
+		if n.value >= 0 {
+			units[pos] |= 1 << 8
+			units[block] = uint32(n.value) | 1<<31
+		}
+		for label, child := range n.children {
+			units[block^uint32(label)] = uint32(label)
+			place(child, block^uint32(label))
+		}
+	}
+	place(root, 0)
+
+	charsMap := binary.LittleEndian.AppendUint32(nil, uint32(len(units)*4))
+	for _, unit := range units {
+		charsMap = binary.LittleEndian.AppendUint32(charsMap, unit)
+	}
+	return append(charsMap, normalized...)
+}
+
+func TestSentencePieceTokenizerNormalize(t *testing.T) {
+	charsMap := buildSPMCharsMap(map[string]string{
+		"\t":       " ",
+		"\n":       " ",
+		"\r":       " ",
+		"\x01":     "",
+		"\u3000":   " ",
+		"\u200b":   " ",
+		"ﬁ":        "fi",
+		"Ｗ":        "W",
+		"Ｗｏ":       "wo",
+		"①":        "1",
+		"\ufeff\t": "  ",
+	})
+	pieces := append([]testSentencePiece{{"fi", -1, spmPieceNormal}}, testSentencePieces...)
+	trainerSpec := appendProtoVarint(nil, 3, spmModelUnigram)
+	normalizerSpec := appendProtoBytes(nil, 2, charsMap)
+	filename := writeSentencePieceModel(t, "tokenizer.model", pieces, trainerSpec, normalizerSpec)
+
+	tokenizer, err := NewSentencePieceTokenizer(filename)
+	if err != nil {
+		t.Fatalf("NewSentencePieceTokenizer() error. err=[%v]", err)
+	}
+	tests := map[string]string{
+		"\tHello\n\x01\u3000ﬁ\u200bWorld\r\n": "▁Hello▁fi▁World",
+		"Ｗorld ①":                             "▁World▁1",
+		"Ｗｏrld":                               "▁world",
+		// the spaces of a normalized string are kept unless a space is before them
+		"\ufeff\tx\ufeff\ty": "▁x▁▁y",
+		"  \xff":             "▁\ufffd",
+		"\r\n":               "",
+	}
+	for text, expected := range tests {
+		if normalized := tokenizer.normalize(text); normalized != expected {
+			t.Errorf("invalid logic. text=%q normalized=%q expected=%q", text, normalized, expected)
+		}
+	}
+
+	if _, err := parseSPMCharsMap(charsMap[:len(charsMap)/2]); err == nil {
+		t.Errorf("invalid logic. expected error for truncated character map")
+	}
+}
+
+func TestSentencePieceTokenizerUserDefined(t *testing.T) {
+	pieces := []testSentencePiece{
+		{"<unk>", 0, spmPieceUnknown},
+		{"▁a", -1, spmPieceNormal},
+		{"ab", -0.5, spmPieceNormal},
+		{"bc", -3, spmPieceNormal},
+		{"▁ab", -2, spmPieceNormal},
+		{"▁", -10, spmPieceNormal},
+		{"a", -10, spmPieceNormal},
+		{"b", -10, spmPieceNormal},
+		{"c", -10, spmPieceNormal},
+		{"<b>", 0, spmPieceUserDefined},
+	}
+	for _, modelType := range []uint64{spmModelUnigram, spmModelBPE} {
+		trainerSpec := appendProtoVarint(nil, 3, modelType)
+		filename := writeSentencePieceModel(t, "tokenizer.model", pieces, trainerSpec, nil)
+		tokenizer, err := NewSentencePieceTokenizer(filename)
+		if err != nil {
+			t.Fatalf("NewSentencePieceTokenizer() error. err=[%v]", err)
+		}
+		// the user-defined piece is matched as a whole and never merged with its neighbours
+		if ids := tokenizer.Encode("ab<b>ab"); !reflect.DeepEqual(ids, []int{4, 9, 2}) {
+			t.Errorf("invalid logic. model=%v ids=%v", modelType, ids)
+		}
+		if ids := tokenizer.Encode("<b>b"); !reflect.DeepEqual(ids, []int{5, 9, 7}) {
+			t.Errorf("invalid logic. model=%v ids=%v", modelType, ids)
+		}
+	}
+}
+
+// sentencePieceGolden is the token ids of the texts encoded by the SentencePiece reference library,
+// written by testdata/sentencepiece/golden.py.
+type sentencePieceGolden struct {
+	Model string `json:"model"`
+	Cases []struct {
+		Text string `json:"text"`
+		IDs  []int  `json:"ids"`
+	} `json:"cases"`
+}
+
+func TestSentencePieceTokenizerGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "sentencepiece", "*.golden.json"))
+	if err != nil {
+		t.Fatalf("filepath.Glob() error. err=[%v]", err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no golden files in testdata/sentencepiece")
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("os.ReadFile() error. err=[%v]", err)
+		}
+		var golden sentencePieceGolden
+		if err := json.Unmarshal(content, &golden); err != nil {
+			t.Fatalf("json.Unmarshal() error. file=%v err=[%v]", file, err)
+		}
+		tokenizer, err := NewSentencePieceTokenizer(filepath.Join(filepath.Dir(file), golden.Model))
+		if err != nil {
+			t.Fatalf("NewSentencePieceTokenizer() error. err=[%v]", err)
+		}
+		for _, c := range golden.Cases {
+			if ids := tokenizer.Encode(c.Text); !reflect.DeepEqual(ids, c.IDs) {
+				t.Errorf("invalid logic. model=%v text=%q ids=%v expected=%v", golden.Model, c.Text, ids, c.IDs)
+			}
+			if count := tokenizer.Count(c.Text); count != len(c.IDs) {
+				t.Errorf("invalid logic. model=%v text=%q count=%v expected=%v", golden.Model, c.Text, count, len(c.IDs))
+			}
+		}
+	}
+}
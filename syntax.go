@@ -0,0 +1,208 @@
+package ctoc
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// declaration is a top-level declaration of a file, lines[start:end].
+type declaration struct {
+	start, end int
+	symbol     string
+}
+
+// declarations returns the top-level declarations covering all the lines, the lines before the first
+// declaration and between the declarations belong to the previous one.
+func declarations(language *Language, lines []chunkLine) []declaration {
+	var decls []declaration
+	if language.Name == "Go" {
+		decls = goDeclarations(lines)
+	}
+	if decls == nil {
+		decls = heuristicDeclarations(language, lines)
+	}
+	if len(decls) == 0 {
+		return []declaration{{start: 0, end: len(lines)}}
+	}
+
+	decls[0].start = 0
+	for i := range decls {
+		if i+1 < len(decls) {
+			decls[i].end = decls[i+1].start
+		} else {
+			decls[i].end = len(lines)
+		}
+	}
+	return decls
+}
+
+// goDeclarations returns the top-level declarations of a Go file, with their doc comments,
+// or nil when the file can not be parsed.
+func goDeclarations(lines []chunkLine) []declaration {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", chunkText(lines), parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+
+	decls := []declaration{{symbol: "package " + file.Name.Name}}
+	for _, decl := range file.Decls {
+		var names []string
+		pos := decl.Pos()
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Doc != nil {
+				pos = decl.Doc.Pos()
+			}
+			name := decl.Name.Name
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				name = receiverName(decl.Recv.List[0].Type) + "." + name
+			}
+			names = append(names, name)
+		case *ast.GenDecl:
+			if decl.Doc != nil {
+				pos = decl.Doc.Pos()
+			}
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.ImportSpec:
+					names = []string{"import"}
+				case *ast.TypeSpec:
+					names = append(names, spec.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						names = append(names, name.Name)
+					}
+				}
+			}
+		}
+		decls = append(decls, declaration{start: fset.Position(pos).Line - 1, symbol: strings.Join(names, ", ")})
+	}
+	return decls
+}
+
+// receiverName returns the name of the type of a method receiver.
+func receiverName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name
+	case *ast.StarExpr:
+		return receiverName(expr.X)
+	case *ast.IndexExpr:
+		return receiverName(expr.X)
+	case *ast.IndexListExpr:
+		return receiverName(expr.X)
+	}
+	return ""
+}
+
+// symbolPattern matches the name of a declaration after its keyword, e.g. "def name" or "class Name".
+var symbolPattern = regexp.MustCompile(`\b(?:func|function|def|class|struct|enum|interface|trait|impl|fn|type|module|object|record|namespace|macro|sub|proc)\s+([A-Za-z_$][\w$]*)`)
+
+// callPattern matches the name before the parameters of a declaration, e.g. "int main(".
+var callPattern = regexp.MustCompile(`([A-Za-z_$][\w$]*)\s*\(`)
+
+// heuristicDeclarations returns the top-level declarations of a file, which start with an unindented code line
+// outside of brackets and not starting with a brace, with the comment lines and the annotations (e.g. @decorator) right before it.
+func heuristicDeclarations(language *Language, lines []chunkLine) []declaration {
+	var decls []declaration
+	depth := 0
+	for i, line := range lines {
+		if line.kind != lineCode {
+			continue
+		}
+		code := stripCode(language, line.text)
+		trimmed := strings.TrimSpace(code)
+		isStart := depth == 0 && trimmed != "" && code[0] != ' ' && code[0] != '\t' && strings.IndexAny(trimmed, "{)]}") != 0
+		for _, c := range code {
+			switch c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				if depth > 0 {
+					depth--
+				}
+			}
+		}
+		if !isStart {
+			continue
+		}
+
+		// an annotation belongs to the next declaration
+		if n := len(decls); n > 0 && isAnnotation(lines[decls[n-1].start:i]) {
+			if decls[n-1].symbol == "" {
+				decls[n-1].symbol = declarationSymbol(trimmed)
+			}
+			continue
+		}
+
+		start := i
+		for start > 0 && lines[start-1].kind == lineComment {
+			start--
+		}
+		decls = append(decls, declaration{start: start, symbol: declarationSymbol(trimmed)})
+	}
+	return decls
+}
+
+// isAnnotation reports whether the code lines are annotations.
+func isAnnotation(lines []chunkLine) bool {
+	annotation := false
+	for _, line := range lines {
+		if line.kind != lineCode {
+			continue
+		}
+		if !strings.HasPrefix(strings.TrimSpace(line.text), "@") {
+			return false
+		}
+		annotation = true
+	}
+	return annotation
+}
+
+// declarationSymbol returns the name of the declaration starting with the code line, or "" when it is not found.
+func declarationSymbol(code string) string {
+	if strings.HasPrefix(code, "@") {
+		return ""
+	}
+	if m := symbolPattern.FindStringSubmatch(code); m != nil {
+		return m[1]
+	}
+	if m := callPattern.FindStringSubmatch(code); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// stripCode returns the code line without the string literals and the trailing line comment,
+// so that their brackets are not counted.
+func stripCode(language *Language, line string) string {
+	var sb strings.Builder
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'', '`':
+			quote = c
+			continue
+		}
+		for _, comment := range language.lineComments {
+			if strings.HasPrefix(line[i:], comment) {
+				return sb.String()
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,37 @@
+#!/usr/bin/env python3
+"""Writes the token ids of the SentencePiece reference library for the golden tests.
+
+Usage: golden.py MODEL OUTPUT [TEXT_FILE...]
+
+The ids of each text file (or of the built-in samples) encoded by MODEL are written to OUTPUT,
+which trim.py turns into a small model and the golden file of the tests.
+"""
+
+import json
+import sys
+
+import sentencepiece as spm
+
+SAMPLES = [
+    "hello world",
+    "  Extra   spaces\tand\ttabs\n",
+    "func main() {\n\tfmt.Println(\"héllo, 世界\")\n}\n",
+    "ﬁ ① Ｆｕｌｌｗｉｄｔｈ",
+    "emoji 🤔 and unknown 𩸽",
+]
+
+
+def main():
+    model, output = sys.argv[1], sys.argv[2]
+    texts = SAMPLES
+    if len(sys.argv) > 3:
+        texts = [open(name, encoding="utf-8").read() for name in sys.argv[3:]]
+
+    sp = spm.SentencePieceProcessor(model_file=model)
+    cases = [{"text": text, "ids": sp.encode(text)} for text in texts]
+    with open(output, "w", encoding="utf-8") as fp:
+        json.dump({"source": "sentencepiece " + spm.__version__, "cases": cases}, fp, ensure_ascii=False, indent=1)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,107 @@
+#!/usr/bin/env python3
+"""Trims a SentencePiece model to the pieces which may be used to encode the texts of a golden file.
+
+Usage: trim.py MODEL GOLDEN NAME
+
+GOLDEN is the JSON file of the texts and their ids encoded by MODEL (written by golden.py), NAME.model
+and NAME.golden.json are written with the kept pieces renumbered. The normal pieces which are not
+substrings of the texts can never be matched, so the ids of the trimmed model are the same as the
+ids of MODEL once renumbered. The control, unknown, user-defined and byte pieces, the normal pieces
+of the lowest and highest scores and the trainer and normalizer specs are kept as they are.
+"""
+
+import json
+import struct
+import sys
+
+NORMAL, UNKNOWN, CONTROL, USER_DEFINED, UNUSED, BYTE = 1, 2, 3, 4, 5, 6
+
+
+def varint(b, i):
+    v, shift = 0, 0
+    while True:
+        c = b[i]
+        i += 1
+        v |= (c & 0x7F) << shift
+        shift += 7
+        if c < 0x80:
+            return v, i
+
+
+def fields(b):
+    i = 0
+    while i < len(b):
+        start = i
+        key, i = varint(b, i)
+        wire = key & 7
+        if wire == 0:
+            v, i = varint(b, i)
+        elif wire == 1:
+            v, i = b[i:i + 8], i + 8
+        elif wire == 2:
+            n, i = varint(b, i)
+            v, i = b[i:i + n], i + n
+        elif wire == 5:
+            v, i = b[i:i + 4], i + 4
+        else:
+            raise ValueError("unsupported wire type %d" % wire)
+        yield key >> 3, wire, v, b[start:i]
+
+
+def piece_of(raw):
+    piece, score, kind = "", 0.0, NORMAL
+    for num, wire, v, _ in fields(raw):
+        if num == 1:
+            piece = v.decode("utf-8")
+        elif num == 2:
+            score = struct.unpack("<f", v)[0]
+        elif num == 3:
+            kind = v
+    return piece, score, kind
+
+
+def main():
+    model, golden, name = sys.argv[1], sys.argv[2], sys.argv[3]
+    with open(model, "rb") as fp:
+        content = fp.read()
+    with open(golden, encoding="utf-8") as fp:
+        cases = json.load(fp)
+
+    pieces, specs = [], []
+    for num, wire, v, raw in fields(content):
+        if num == 1:
+            pieces.append((piece_of(v), raw))
+        elif num in (2, 3):
+            specs.append(raw)
+
+    # the normal pieces may only match substrings of the texts, as they are or normalized by the ids
+    texts = []
+    for case in cases["cases"]:
+        texts.append(case["text"].replace(" ", "▁"))
+        texts.append("".join(pieces[i][0][0] for i in case["ids"]))
+    normal = [i for i, ((_, _, kind), _) in enumerate(pieces) if kind == NORMAL]
+    extremes = {min(normal, key=lambda i: pieces[i][0][1]), max(normal, key=lambda i: pieces[i][0][1])}
+    keep = [i for i, ((piece, _, kind), _) in enumerate(pieces)
+            if kind not in (NORMAL, UNUSED) or i in extremes or (kind == NORMAL and any(piece in text for text in texts))]
+
+    ids = {old: new for new, old in enumerate(keep)}
+    out = bytearray()
+    for i in keep:
+        raw = pieces[i][1]
+        out += raw
+    for raw in specs:
+        out += raw
+    with open(name + ".model", "wb") as fp:
+        fp.write(out)
+
+    cases["model"] = name.rsplit("/", 1)[-1] + ".model"
+    for case in cases["cases"]:
+        case["ids"] = [ids[i] for i in case["ids"]]
+    with open(name + ".golden.json", "w", encoding="utf-8") as fp:
+        fp.write('{\n "model": %s,\n "source": %s,\n "cases": [\n' % (json.dumps(cases["model"]), json.dumps(cases["source"])))
+        fp.write(",\n".join("  " + json.dumps(case, ensure_ascii=False) for case in cases["cases"]))
+        fp.write("\n ]\n}\n")
+
+
+if __name__ == "__main__":
+    main()
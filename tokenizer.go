@@ -0,0 +1,111 @@
+package ctoc
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// DefaultEncoding is the tokenizer encoding used when none is specified.
+const DefaultEncoding string = "cl100k_base"
+
+// Tokenizer splits text into LLM tokens.
+type Tokenizer interface {
+	// Encode returns the token ids for text.
+	Encode(text string) []int
+	// Count returns the number of tokens for text.
+	Count(text string) int
+	// Name returns the encoding name of the tokenizer.
+	Name() string
+}
+
+// TiktokenTokenizer is a Tokenizer backed by tiktoken-go encodings.
+type TiktokenTokenizer struct {
+	name string
+	tke  *tiktoken.Tiktoken
+	// digest identifies the ranks loaded from local files by SetBpePath, it is empty for the downloaded ones.
+	digest string
+}
+
+// NewTiktokenTokenizer returns TiktokenTokenizer for a built-in or registered encoding name.
+func NewTiktokenTokenizer(encoding string) (*TiktokenTokenizer, error) {
+	tke, err := getTiktoken(encoding)
+	if err != nil {
+		return nil, err
+	}
+	t := &TiktokenTokenizer{
+		name: encoding,
+		tke:  tke,
+	}
+	if loader, ok := currentBpeLoader().(*LocalBpeLoader); ok {
+		t.digest = loader.digest()
+	}
+	return t, nil
+}
+
+// Encode returns the token ids for text, special tokens are encoded as normal text.
+func (t *TiktokenTokenizer) Encode(text string) []int {
+	return t.tke.Encode(text, nil, nil)
+}
+
+// Count returns the number of tokens for text.
+func (t *TiktokenTokenizer) Count(text string) int {
+	return len(t.Encode(text))
+}
+
+// Name returns the encoding name.
+func (t *TiktokenTokenizer) Name() string {
+	return t.name
+}
+
+func (t *TiktokenTokenizer) definitionDigest() string {
+	return t.digest
+}
+
+// TokenizerForModel returns TiktokenTokenizer for the encoding used by the model.
+func TokenizerForModel(model string) (*TiktokenTokenizer, error) {
+	encoding, err := EncodingForModel(model)
+	if err != nil {
+		return nil, err
+	}
+	return NewTiktokenTokenizer(encoding)
+}
+
+// tokenizerNameFromFile returns the tokenizer name for a tokenizer file, which is
+// the file name without extension, or its directory name for files named tokenizer.*.
+func tokenizerNameFromFile(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	if name == "tokenizer" {
+		if abs, err := filepath.Abs(filename); err == nil {
+			name = filepath.Base(filepath.Dir(abs))
+		}
+	}
+	return name
+}
+
+// TokensByEncoding is the token counts keyed by encoding name.
+type TokensByEncoding map[string]int32
+
+// Names returns the encoding names in sorted order.
+func (t TokensByEncoding) Names() []string {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *TokensByEncoding) add(tokens TokensByEncoding) {
+	if len(tokens) == 0 {
+		return
+	}
+	if *t == nil {
+		*t = make(TokensByEncoding, len(tokens))
+	}
+	for name, n := range tokens {
+		(*t)[name] += n
+	}
+}
@@ -0,0 +1,117 @@
+package ctoc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// wordTokenizer is a Tokenizer test double that treats each word as a token.
+type wordTokenizer struct{}
+
+func (wordTokenizer) Encode(text string) []int {
+	return make([]int, len(strings.Fields(text)))
+}
+
+func (w wordTokenizer) Count(text string) int {
+	return len(w.Encode(text))
+}
+
+func (wordTokenizer) Name() string {
+	return "word"
+}
+
+func TestTiktokenTokenizer(t *testing.T) {
+	tke, err := NewTiktokenTokenizer(DefaultEncoding)
+	if err != nil {
+		t.Fatalf("NewTiktokenTokenizer() error. err=[%v]", err)
+	}
+	if tke.Name() != DefaultEncoding {
+		t.Errorf("invalid name. name=%v", tke.Name())
+	}
+	if n := tke.Count("hello world"); n != 2 {
+		t.Errorf("invalid logic. tokens=%v", n)
+	}
+}
+
+func TestNewTiktokenTokenizerUnknownEncoding(t *testing.T) {
+	if _, err := NewTiktokenTokenizer("unknown_base"); err == nil {
+		t.Errorf("invalid logic. unknown encoding should fail")
+	}
+}
+
+func TestAnalyzeReaderWithCustomTokenizer(t *testing.T) {
+	buf := bytes.NewBuffer([]byte(`package main
+
+// hello world
+func main() {}
+`))
+
+	language := NewLanguage("Go", []string{"//"}, [][]string{{"/*", "*/"}})
+	clocOpts := NewClocOptions()
+	clocOpts.Tokenizer = wordTokenizer{}
+	clocFile := AnalyzeReader("test.go", language, buf, clocOpts)
+
+	if clocFile.Tokens != 8 {
+		t.Errorf("invalid logic. tokens=%v", clocFile.Tokens)
+	}
+}
+
+func TestAnalyzeReaderWithoutTokenizer(t *testing.T) {
+	buf := bytes.NewBuffer([]byte("package main\n"))
+
+	language := NewLanguage("Go", []string{"//"}, [][]string{{"/*", "*/"}})
+	clocFile := AnalyzeReader("test.go", language, buf, &ClocOptions{})
+
+	if clocFile.Code != 1 {
+		t.Errorf("invalid logic. code=%v", clocFile.Code)
+	}
+	if clocFile.Tokens != 0 {
+		t.Errorf("invalid logic. tokens=%v", clocFile.Tokens)
+	}
+}
+
+func TestTokenizerForModel(t *testing.T) {
+	tke, err := TokenizerForModel("gpt-4o")
+	if err != nil {
+		t.Fatalf("TokenizerForModel() error. err=[%v]", err)
+	}
+	if tke.Name() != "o200k_base" {
+		t.Errorf("invalid name. name=%v", tke.Name())
+	}
+
+	if _, err := TokenizerForModel("unknown-model"); err == nil {
+		t.Errorf("invalid logic. unknown model should fail")
+	}
+}
+
+func TestAnalyzeReaderWithMultipleTokenizers(t *testing.T) {
+	src := "package main\n\nfunc main() {}\n"
+	language := NewLanguage("Go", []string{"//"}, [][]string{{"/*", "*/"}})
+	clocOpts := NewClocOptions()
+	o200k, err := NewTiktokenTokenizer("o200k_base")
+	if err != nil {
+		t.Fatalf("NewTiktokenTokenizer() error. err=[%v]", err)
+	}
+	clocOpts.Tokenizers = []Tokenizer{o200k, wordTokenizer{}}
+	clocFile := AnalyzeReader("test.go", language, bytes.NewBufferString(src), clocOpts)
+
+	if names := clocFile.EncodingTokens.Names(); len(names) != 3 {
+		t.Fatalf("invalid logic. encodings=%v", names)
+	}
+	if clocFile.EncodingTokens[DefaultEncoding] != clocFile.Tokens {
+		t.Errorf("invalid logic. tokens=%v encoding_tokens=%v", clocFile.Tokens, clocFile.EncodingTokens)
+	}
+	if clocFile.EncodingTokens["word"] != 5 {
+		t.Errorf("invalid logic. word tokens=%v", clocFile.EncodingTokens["word"])
+	}
+	if clocFile.EncodingTokens["o200k_base"] == 0 {
+		t.Errorf("invalid logic. o200k_base tokens=%v", clocFile.EncodingTokens["o200k_base"])
+	}
+
+	clocOpts.WholeFile = true
+	clocFile = AnalyzeReader("test.go", language, bytes.NewBufferString(src), clocOpts)
+	if expected := int32(o200k.Count(src)); clocFile.EncodingTokens["o200k_base"] != expected {
+		t.Errorf("invalid logic. o200k_base tokens=%v expected=%v", clocFile.EncodingTokens["o200k_base"], expected)
+	}
+}
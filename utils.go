@@ -3,6 +3,7 @@ package ctoc
 import (
 	"crypto/md5"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -37,8 +38,8 @@ func nextRune(s string) rune {
 	return 0
 }
 
-func checkMD5Sum(path string, fileCache map[string]struct{}) (ignore bool) {
-	content, err := os.ReadFile(path)
+func checkMD5Sum(path string, opts *ClocOptions, fileCache map[string]struct{}) (ignore bool) {
+	content, err := opts.readFile(path)
 	if err != nil {
 		return true
 	}
@@ -101,61 +102,188 @@ func checkOptionMatch(path string, info os.FileInfo, opts *ClocOptions) bool {
 	return true
 }
 
+// checkLanguageOption reports whether the language is not excluded by the exclude extension and include language options.
+func checkLanguageOption(targetExt string, opts *ClocOptions) bool {
+	if _, ok := opts.ExcludeExts[targetExt]; ok {
+		return false
+	}
+	if len(opts.IncludeLangs) != 0 {
+		if _, ok := opts.IncludeLangs[targetExt]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // getAllFiles return all the files to be analyzed in paths.
 func getAllFiles(paths []string, languages *DefinedLanguages, opts *ClocOptions) (result map[string]*Language, err error) {
+	if opts.VCS != "" {
+		return getVCSFiles(paths, languages, opts)
+	}
+
 	result = make(map[string]*Language)
 	fileCache := make(map[string]struct{})
 
 	for _, root := range paths {
+		if info, statErr := os.Stat(root); statErr == nil && !info.IsDir() && isArchive(root) {
+			if err = addArchiveFiles(result, root, languages, opts, fileCache); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
 		vcsInRoot := isVCSDir(root)
+		var ignore *ignoreMatcher
+		if !opts.NoIgnore {
+			ignore = newIgnoreMatcher(root)
+		}
 		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err := opts.context().Err(); err != nil {
+				return err
+			}
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "%s\n", err)
 				return nil
 			}
+			if ignore != nil {
+				// paths given explicitly are never ignored
+				if path != root && ignore.isIgnored(path, info.IsDir()) {
+					if opts.Debug {
+						fmt.Printf("[ignore=%v] ignored by ignore files\n", path)
+					}
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if info.IsDir() {
+					ignore.enter(path)
+				}
+			}
 			if ignore := checkDefaultIgnore(path, info, vcsInRoot); ignore {
 				return nil
 			}
 
+			// the files in the archive are matched instead of the archive
+			if !info.IsDir() && isArchive(path) {
+				if err := addArchiveFiles(result, path, languages, opts, fileCache); err != nil && opts.context().Err() == nil {
+					fmt.Fprintf(os.Stderr, "%s\n", err)
+				}
+				return nil
+			}
+
 			// check match & not-match directory
 			if match := checkOptionMatch(path, info, opts); !match {
 				return nil
 			}
 
-			if ext, ok := getFileType(path, opts); ok {
-				if targetExt, ok := Exts[ext]; ok {
-					// check exclude extension
-					if _, ok := opts.ExcludeExts[targetExt]; ok {
-						return nil
-					}
+			addFile(result, path, languages, opts, fileCache)
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
 
-					if len(opts.IncludeLangs) != 0 {
-						if _, ok = opts.IncludeLangs[targetExt]; !ok {
-							return nil
-						}
-					}
+// getFSFiles return all the files to be analyzed in roots of fsys.
+func getFSFiles(fsys fs.FS, roots []string, languages *DefinedLanguages, opts *ClocOptions) (map[string]*Language, error) {
+	result := make(map[string]*Language)
+	fileCache := make(map[string]struct{})
 
-					if !opts.SkipDuplicated {
-						ignore := checkMD5Sum(path, fileCache)
-						if ignore {
-							if opts.Debug {
-								fmt.Printf("[ignore=%v] find same md5\n", path)
-							}
-							return nil
-						}
+	for _, root := range roots {
+		if !fs.ValidPath(root) {
+			return nil, &fs.PathError{Op: "walk", Path: root, Err: fs.ErrInvalid}
+		}
+		vcsInRoot := isVCSDir(root)
+		var ignore *ignoreMatcher
+		if !opts.NoIgnore {
+			ignore = newFSIgnoreMatcher(fsys, root)
+		}
+		err := fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+			if err := opts.context().Err(); err != nil {
+				return err
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return nil
+			}
+			if ignore != nil {
+				// roots given explicitly are never ignored
+				if path != root && ignore.isIgnored(path, d.IsDir()) {
+					if opts.Debug {
+						fmt.Printf("[ignore=%v] ignored by ignore files\n", path)
 					}
-
-					if _, ok := result[targetExt]; !ok {
-						result[targetExt] = NewLanguage(
-							languages.Langs[targetExt].Name,
-							languages.Langs[targetExt].lineComments,
-							languages.Langs[targetExt].multiLines)
+					if d.IsDir() {
+						return fs.SkipDir
 					}
-					result[targetExt].Files = append(result[targetExt].Files, path)
+					return nil
+				}
+				if d.IsDir() {
+					ignore.enter(path)
+				}
+			}
+			info, err := d.Info()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return nil
+			}
+			if ignore := checkDefaultIgnore(path, info, vcsInRoot); ignore {
+				return nil
+			}
+
+			// the files in the archive are matched instead of the archive
+			if !info.IsDir() && isArchive(path) {
+				if err := addArchiveFiles(result, path, languages, opts, fileCache); err != nil && opts.context().Err() == nil {
+					fmt.Fprintf(os.Stderr, "%s\n", err)
 				}
+				return nil
+			}
+
+			// check match & not-match directory
+			if match := checkOptionMatch(path, info, opts); !match {
+				return nil
 			}
+
+			addFile(result, path, languages, opts, fileCache)
 			return nil
 		})
+		if err != nil {
+			return result, err
+		}
 	}
-	return
+	return result, nil
+}
+
+// addFile adds the file to the language of its file type in result and returns the language,
+// or returns nil when the file is excluded by opts.
+func addFile(result map[string]*Language, path string, languages *DefinedLanguages, opts *ClocOptions, fileCache map[string]struct{}) *Language {
+	if ext, ok := getFileType(path, opts); ok {
+		if targetExt, ok := Exts[ext]; ok {
+			if !checkLanguageOption(targetExt, opts) {
+				return nil
+			}
+
+			if !opts.SkipDuplicated {
+				ignore := checkMD5Sum(path, opts, fileCache)
+				if ignore {
+					if opts.Debug {
+						fmt.Printf("[ignore=%v] find same md5\n", path)
+					}
+					return nil
+				}
+			}
+
+			if _, ok := result[targetExt]; !ok {
+				result[targetExt] = NewLanguage(
+					languages.Langs[targetExt].Name,
+					languages.Langs[targetExt].lineComments,
+					languages.Langs[targetExt].multiLines)
+			}
+			result[targetExt].Files = append(result[targetExt].Files, path)
+			return result[targetExt]
+		}
+	}
+	return nil
 }
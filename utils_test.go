@@ -24,10 +24,10 @@ func TestContainsComment(t *testing.T) {
 func TestCheckMD5SumIgnore(t *testing.T) {
 	fileCache := make(map[string]struct{})
 
-	if checkMD5Sum("./utils_test.go", fileCache) {
+	if checkMD5Sum("./utils_test.go", NewClocOptions(), fileCache) {
 		t.Errorf("invalid sequence")
 	}
-	if !checkMD5Sum("./utils_test.go", fileCache) {
+	if !checkMD5Sum("./utils_test.go", NewClocOptions(), fileCache) {
 		t.Errorf("invalid sequence")
 	}
 }
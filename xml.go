@@ -3,6 +3,9 @@ package ctoc
 import (
 	"encoding/xml"
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
 // XMLResultType is the result type in XML format.
@@ -22,6 +25,14 @@ type XMLTotalLanguages struct {
 	Comment  int32 `xml:"comment,attr"`
 	Blank    int32 `xml:"blank,attr"`
 	Tokens   int32 `xml:"tokens,attr"`
+
+	CodeTokens    int32 `xml:"code_tokens,attr"`
+	CommentTokens int32 `xml:"comment_tokens,attr"`
+	BlankTokens   int32 `xml:"blank_tokens,attr"`
+	TokensError   int32 `xml:"tokens_error,attr,omitempty"`
+
+	EncodingTokens TokensByEncoding `xml:"-"`
+	Costs          CostByModel      `xml:"-"`
 }
 
 // XMLResultLanguages stores the results in XML format.
@@ -36,6 +47,14 @@ type XMLTotalFiles struct {
 	Comment int32 `xml:"comment,attr"`
 	Blank   int32 `xml:"blank,attr"`
 	Tokens  int32 `xml:"tokens,attr"`
+
+	CodeTokens    int32 `xml:"code_tokens,attr"`
+	CommentTokens int32 `xml:"comment_tokens,attr"`
+	BlankTokens   int32 `xml:"blank_tokens,attr"`
+	TokensError   int32 `xml:"tokens_error,attr,omitempty"`
+
+	EncodingTokens TokensByEncoding `xml:"-"`
+	Costs          CostByModel      `xml:"-"`
 }
 
 // XMLResultFiles stores per file results in XML format.
@@ -47,6 +66,8 @@ type XMLResultFiles struct {
 // XMLResult stores the results in XML format.
 type XMLResult struct {
 	XMLName      xml.Name            `xml:"results"`
+	Model        string              `xml:"model,attr,omitempty"`
+	Incomplete   bool                `xml:"incomplete,attr,omitempty"`
 	XMLFiles     *XMLResultFiles     `xml:"files,omitempty"`
 	XMLLanguages *XMLResultLanguages `xml:"languages,omitempty"`
 }
@@ -59,6 +80,78 @@ func (x *XMLResult) Encode() {
 	}
 }
 
+// MarshalXML outputs ClocFile with the token counts of each encoding as tokens_<encoding> attributes
+// and the costs of each model as cost_<model> attributes.
+func (cf ClocFile) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type clocFile ClocFile
+	return e.EncodeElement(struct {
+		clocFile
+		Attrs []xml.Attr `xml:",any,attr"`
+	}{clocFile(cf), append(cf.EncodingTokens.xmlAttrs(), cf.Costs.xmlAttrs()...)}, start)
+}
+
+// MarshalXML outputs ClocLanguage with the token counts of each encoding as tokens_<encoding> attributes
+// and the costs of each model as cost_<model> attributes.
+func (cl ClocLanguage) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type clocLanguage ClocLanguage
+	return e.EncodeElement(struct {
+		clocLanguage
+		Attrs []xml.Attr `xml:",any,attr"`
+	}{clocLanguage(cl), append(cl.EncodingTokens.xmlAttrs(), cl.Costs.xmlAttrs()...)}, start)
+}
+
+// MarshalXML outputs XMLTotalLanguages with the token counts of each encoding as tokens_<encoding> attributes
+// and the costs of each model as cost_<model> attributes.
+func (t XMLTotalLanguages) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type xmlTotalLanguages XMLTotalLanguages
+	return e.EncodeElement(struct {
+		xmlTotalLanguages
+		Attrs []xml.Attr `xml:",any,attr"`
+	}{xmlTotalLanguages(t), append(t.EncodingTokens.xmlAttrs(), t.Costs.xmlAttrs()...)}, start)
+}
+
+// MarshalXML outputs XMLTotalFiles with the token counts of each encoding as tokens_<encoding> attributes
+// and the costs of each model as cost_<model> attributes.
+func (t XMLTotalFiles) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type xmlTotalFiles XMLTotalFiles
+	return e.EncodeElement(struct {
+		xmlTotalFiles
+		Attrs []xml.Attr `xml:",any,attr"`
+	}{xmlTotalFiles(t), append(t.EncodingTokens.xmlAttrs(), t.Costs.xmlAttrs()...)}, start)
+}
+
+// xmlAttrName returns the name with the characters not allowed in XML attribute names replaced by "_", e.g. cost_org_model.
+func xmlAttrName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func (c CostByModel) xmlAttrs() []xml.Attr {
+	var attrs []xml.Attr
+	for _, name := range c.Names() {
+		attrs = append(attrs, xml.Attr{
+			Name:  xml.Name{Local: xmlAttrName("cost_" + name)},
+			Value: strconv.FormatFloat(c[name], 'f', -1, 64),
+		})
+	}
+	return attrs
+}
+
+func (t TokensByEncoding) xmlAttrs() []xml.Attr {
+	var attrs []xml.Attr
+	for _, name := range t.Names() {
+		attrs = append(attrs, xml.Attr{
+			Name:  xml.Name{Local: xmlAttrName("tokens_" + name)},
+			Value: strconv.Itoa(int(t[name])),
+		})
+	}
+	return attrs
+}
+
 // NewXMLResultFromCloc returns XMLResult with default data set.
 func NewXMLResultFromCloc(total *Language, sortedLanguages Languages, _ XMLResultType) *XMLResult {
 	var langs []ClocLanguage
@@ -70,6 +163,14 @@ func NewXMLResultFromCloc(total *Language, sortedLanguages Languages, _ XMLResul
 			Comments:   language.Comments,
 			Blanks:     language.Blanks,
 			Tokens:     language.Tokens,
+
+			CodeTokens:    language.CodeTokens,
+			CommentTokens: language.CommentTokens,
+			BlankTokens:   language.BlankTokens,
+			TokensError:   language.TokensError,
+
+			EncodingTokens: language.EncodingTokens,
+			Costs:          language.Costs,
 		}
 		langs = append(langs, c)
 	}
@@ -79,6 +180,14 @@ func NewXMLResultFromCloc(total *Language, sortedLanguages Languages, _ XMLResul
 		Blank:    total.Blanks,
 		Tokens:   total.Tokens,
 		SumFiles: total.Total,
+
+		CodeTokens:    total.CodeTokens,
+		CommentTokens: total.CommentTokens,
+		BlankTokens:   total.BlankTokens,
+		TokensError:   total.TokensError,
+
+		EncodingTokens: total.EncodingTokens,
+		Costs:          total.Costs,
 	}
 	f := &XMLResultLanguages{
 		Languages: langs,
@@ -89,3 +198,31 @@ func NewXMLResultFromCloc(total *Language, sortedLanguages Languages, _ XMLResul
 		XMLLanguages: f,
 	}
 }
+
+// XMLDiffResult stores the diff results in XML format.
+type XMLDiffResult struct {
+	XMLName   xml.Name  `xml:"diff_results"`
+	Model     string    `xml:"model,attr,omitempty"`
+	Languages DiffStats `xml:"languages>language,omitempty"`
+	Files     DiffStats `xml:"files>file,omitempty"`
+	Total     DiffStat  `xml:"total"`
+}
+
+// Encode outputs XMLDiffResult in a human readable format.
+func (x *XMLDiffResult) Encode() {
+	if output, err := xml.MarshalIndent(x, "", "  "); err == nil {
+		fmt.Printf(xml.Header)
+		fmt.Println(string(output))
+	}
+}
+
+// NewXMLDiffResult returns XMLDiffResult with the stats of each language, or of each file with byFile.
+func NewXMLDiffResult(diff *DiffResult, byFile bool) *XMLDiffResult {
+	result := &XMLDiffResult{Total: *diff.Total}
+	if byFile {
+		result.Files = sortedDiffStats(diff.Files)
+	} else {
+		result.Languages = sortedDiffStats(diff.Languages)
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package ctoc
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestOutputXMLWithEncodingTokens(t *testing.T) {
+	files := []ClocFile{
+		{Name: "one.go", Lang: "Go", Tokens: 3, EncodingTokens: TokensByEncoding{"o200k_base": 2, "cl100k_base": 3}},
+	}
+	result := XMLResult{
+		XMLFiles: &XMLResultFiles{
+			Files: files,
+			Total: XMLTotalFiles{Tokens: 3, EncodingTokens: TokensByEncoding{"o200k_base": 2, "cl100k_base": 3}},
+		},
+	}
+
+	buf, err := xml.Marshal(result)
+	if err != nil {
+		t.Fatalf("xml marshal error. err=[%v]", err)
+	}
+
+	expected := `<results><files>` +
+		`<file code="0" comment="0" blank="0" name="one.go" language="Go" tokens="3" code_tokens="0" comment_tokens="0" blank_tokens="0" tokens_cl100k_base="3" tokens_o200k_base="2"></file>` +
+		`<total code="0" comment="0" blank="0" tokens="3" code_tokens="0" comment_tokens="0" blank_tokens="0" tokens_cl100k_base="3" tokens_o200k_base="2"></total>` +
+		`</files></results>`
+	if string(buf) != expected {
+		t.Errorf("invalid result. '%s'", string(buf))
+	}
+}
+
+func TestOutputXMLWithCosts(t *testing.T) {
+	result := XMLResult{
+		XMLLanguages: &XMLResultLanguages{
+			Languages: []ClocLanguage{{Name: "Go", Tokens: 1000, Costs: CostByModel{"gpt-4o": 0.0025, "org/model v1": 0.001}}},
+			Total:     XMLTotalLanguages{Tokens: 1000, Costs: CostByModel{"gpt-4o": 0.0025}},
+		},
+	}
+
+	buf, err := xml.Marshal(result)
+	if err != nil {
+		t.Fatalf("xml marshal error. err=[%v]", err)
+	}
+
+	expected := `<results><languages>` +
+		`<language name="Go" files_count="0" code="0" comment="0" blank="0" tokens="1000" code_tokens="0" comment_tokens="0" blank_tokens="0" cost_gpt-4o="0.0025" cost_org_model_v1="0.001"></language>` +
+		`<total sum_files="0" code="0" comment="0" blank="0" tokens="1000" code_tokens="0" comment_tokens="0" blank_tokens="0" cost_gpt-4o="0.0025"></total>` +
+		`</languages></results>`
+	if string(buf) != expected {
+		t.Errorf("invalid result. '%s'", string(buf))
+	}
+}